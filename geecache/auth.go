@@ -0,0 +1,230 @@
+package geecache
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnauthenticated 表示请求没有携带凭证或者凭证无效，HTTP返回401，gRPC返回codes.Unauthenticated
+	ErrUnauthenticated = errors.New("geecache: unauthenticated")
+	// ErrPermissionDenied 表示调用方没有权限访问这个Group，HTTP返回403，gRPC返回codes.PermissionDenied
+	ErrPermissionDenied = errors.New("geecache: permission denied")
+)
+
+// Authenticator 认证其他节点或客户端发来的请求，并给自己发出的请求加上凭证。
+// 凭证放在HTTP的Authorization头或者gRPC的authorization元数据中
+type Authenticator interface {
+	// Token 返回发出请求时携带的凭证
+	Token(ctx context.Context) (string, error)
+	// Authenticate 校验请求携带的凭证，返回调用方的名字，凭证无效时返回的错误包装了ErrUnauthenticated
+	Authenticate(ctx context.Context, token string) (caller string, err error)
+}
+
+// Permission 是对Group的操作权限，可以按位组合
+type Permission int
+
+const (
+	PermRead       Permission = 1 << iota // Get和GetMulti；对集群是查看metrics
+	PermWrite                             // Set、副本推送和转移key；对集群是推送副本和转移key
+	PermDelete                            // Remove
+	PermMembership                        // 只对集群：修改节点列表，比如离开通知
+
+	PermAll = PermRead | PermWrite | PermDelete | PermMembership
+)
+
+func (p Permission) String() string {
+	var names []string
+	for _, perm := range []struct {
+		p    Permission
+		name string
+	}{{PermRead, "read"}, {PermWrite, "write"}, {PermDelete, "delete"}, {PermMembership, "membership"}} {
+		if p&perm.p != 0 {
+			names = append(names, perm.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// Policy 决定调用方能否对Group或者集群执行操作
+type Policy interface {
+	Allow(caller string, perm Permission) bool
+}
+
+// ACL 是按调用方名字授权的Policy，名字找不到时使用"*"的权限
+type ACL map[string]Permission
+
+func (a ACL) Allow(caller string, perm Permission) bool {
+	granted, ok := a[caller]
+	if !ok {
+		granted = a["*"]
+	}
+	return granted&perm == perm
+}
+
+// WithPolicy 设置其他节点和客户端访问这个Group的权限，调用方的名字由HTTPPool和GRPCPool的
+// Authenticator认证得到，没有设置Authenticator时调用方的名字为空。默认不限制
+func WithPolicy(p Policy) GroupOption {
+	return func(g *Group) {
+		g.policy = p
+	}
+}
+
+// Authorize 检查caller能否对g执行perm操作，没有权限时返回的错误包装了ErrPermissionDenied。
+// 本地直接调用Get等方法不做检查，自己提供对外接口（比如main.go的/api）时可以用它检查权限
+func (g *Group) Authorize(caller string, perm Permission) error {
+	if g.policy == nil || g.policy.Allow(caller, perm) {
+		return nil
+	}
+	return groupDenied(caller, perm, g.name)
+}
+
+func groupDenied(caller string, perm Permission, name string) error {
+	return fmt.Errorf("%w: %q cannot %s group %s", ErrPermissionDenied, caller, perm, name)
+}
+
+// 查找其他节点请求的Group并检查caller的权限。Group不存在时按集群的权限检查，
+// 没有权限的调用方得到和没有Group权限一样的错误，不能借此枚举Group的名字；
+// 有权限时才返回errNoSuchGroup
+func authorizeGroup(clusterPolicy Policy, name, caller string, perm Permission) (*Group, error) {
+	group := GetGroup(name)
+	if group == nil {
+		if authorizeCluster(clusterPolicy, caller, perm) != nil {
+			return nil, groupDenied(caller, perm, name)
+		}
+		return nil, fmt.Errorf("%w: %s", errNoSuchGroup, name)
+	}
+	if err := group.Authorize(caller, perm); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+var errNoSuchGroup = errors.New("no such group")
+
+// 检查caller能否执行集群级操作，policy为nil时不限制
+func authorizeCluster(policy Policy, caller string, perm Permission) error {
+	if policy == nil || policy.Allow(caller, perm) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q cannot %s the cluster", ErrPermissionDenied, caller, perm)
+}
+
+// AuthenticateHTTP 用auth认证HTTP请求的Authorization头，返回调用方的名字，auth为nil时不认证
+func AuthenticateHTTP(auth Authenticator, r *http.Request) (caller string, err error) {
+	return authenticate(r.Context(), auth, r.Header.Get("Authorization"))
+}
+
+func authenticate(ctx context.Context, auth Authenticator, token string) (string, error) {
+	if auth == nil {
+		return "", nil
+	}
+	if token == "" {
+		return "", fmt.Errorf("%w: missing credentials", ErrUnauthenticated)
+	}
+	return auth.Authenticate(ctx, token)
+}
+
+// ---------------------HMAC 所有节点共享一个密钥--------------------
+
+// HMAC凭证的有效期，也是允许的最大时钟偏差
+const defaultHMACSkew = 5 * time.Minute
+
+type hmacAuth struct {
+	name   string
+	secret []byte
+	skew   time.Duration
+}
+
+// NewHMACAuth 返回使用共享密钥的Authenticator，适合集群内部的节点之间互相认证。
+// 凭证是 "HMAC 名字:时间戳:签名"，签名覆盖名字和时间戳，超过5分钟的凭证无效；
+// 认证通过后调用方的名字就是对方的name，可以用在ACL中
+func NewHMACAuth(name string, secret []byte) Authenticator {
+	return &hmacAuth{name: name, secret: secret, skew: defaultHMACSkew}
+}
+
+func (a *hmacAuth) sign(name, ts string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(name + "\n" + ts))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *hmacAuth) Token(ctx context.Context) (string, error) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	return "HMAC " + a.name + ":" + ts + ":" + a.sign(a.name, ts), nil
+}
+
+func (a *hmacAuth) Authenticate(ctx context.Context, token string) (string, error) {
+	cred, ok := strings.CutPrefix(token, "HMAC ")
+	if !ok {
+		return "", fmt.Errorf("%w: not an HMAC token", ErrUnauthenticated)
+	}
+	// 名字中可能有冒号（比如节点地址），从后往前切分
+	i := strings.LastIndexByte(cred, ':')
+	if i < 0 {
+		return "", fmt.Errorf("%w: malformed HMAC token", ErrUnauthenticated)
+	}
+	rest, sig := cred[:i], cred[i+1:]
+	j := strings.LastIndexByte(rest, ':')
+	if j < 0 {
+		return "", fmt.Errorf("%w: malformed HMAC token", ErrUnauthenticated)
+	}
+	name, ts := rest[:j], rest[j+1:]
+	if !hmac.Equal([]byte(sig), []byte(a.sign(name, ts))) {
+		return "", fmt.Errorf("%w: bad HMAC signature", ErrUnauthenticated)
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed HMAC token", ErrUnauthenticated)
+	}
+	if d := time.Since(time.Unix(sec, 0)); d > a.skew || d < -a.skew {
+		return "", fmt.Errorf("%w: HMAC token expired", ErrUnauthenticated)
+	}
+	return name, nil
+}
+
+// ---------------------Bearer 每个调用方一个token--------------------
+
+type bearerAuth struct {
+	token   string            // 自己发出请求时使用的token
+	callers map[string]string // token -> 调用方的名字
+}
+
+// NewBearerAuth 返回使用静态token的Authenticator，callers是token到调用方名字的映射，
+// 适合给不同的客户端发放不同的token。token是自己发出请求时携带的，只接受请求时可以为空
+func NewBearerAuth(token string, callers map[string]string) Authenticator {
+	return &bearerAuth{token: token, callers: callers}
+}
+
+func (a *bearerAuth) Token(ctx context.Context) (string, error) {
+	if a.token == "" {
+		return "", errors.New("geecache: no bearer token configured")
+	}
+	return "Bearer " + a.token, nil
+}
+
+func (a *bearerAuth) Authenticate(ctx context.Context, token string) (string, error) {
+	t, ok := strings.CutPrefix(token, "Bearer ")
+	if !ok {
+		return "", fmt.Errorf("%w: not a bearer token", ErrUnauthenticated)
+	}
+	// 逐个比较，避免按时间差猜出token
+	for known, caller := range a.callers {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(known)) == 1 {
+			return caller, nil
+		}
+	}
+	return "", fmt.Errorf("%w: unknown bearer token", ErrUnauthenticated)
+}
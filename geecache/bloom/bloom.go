@@ -0,0 +1,161 @@
+package bloom
+
+/*
+bloom 提供三种Bloom过滤器，用来在查询数据源之前排除一定不存在的key（缓存穿透）：
+1. Filter：标准Bloom过滤器，只能添加不能删除，可以用Merge合并其他节点的过滤器；
+2. CountingFilter：每一位换成一个计数器，可以删除key；
+3. ScalableFilter：装满之后自动追加一个更大的Filter，不需要预先知道key的数量。
+Test返回false说明key一定不存在，返回true说明key可能存在。
+所有过滤器都是并发安全的，并且实现了encoding.BinaryMarshaler，可以序列化之后发给其他节点。
+*/
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// 序列化格式的第一个字节，区分过滤器的种类
+const (
+	typeFilter byte = iota + 1
+	typeCounting
+	typeScalable
+)
+
+var errCorrupt = errors.New("bloom: corrupt data")
+
+// EstimateParameters 根据预计的key数量n和期望的误判率fp，计算需要的位数m和哈希函数个数k
+func EstimateParameters(n uint64, fp float64) (m uint64, k uint32) {
+	if n == 0 {
+		n = 1
+	}
+	m = uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	k = uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return max(m, 1), k
+}
+
+// 计算key的两个哈希值，第i个哈希函数是 h1+i*h2 (Kirsch-Mitzenmacher)，
+// 哈希函数必须是固定的，序列化之后在其他节点上才能用
+func hashes(key string) (h1, h2 uint64) {
+	// FNV-1a
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	// splitmix64的混合函数，由h1得到一个独立的h2
+	z := h + 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return h, z | 1
+}
+
+// Filter 是标准Bloom过滤器
+type Filter struct {
+	mu   sync.RWMutex
+	bits []uint64
+	m    uint64 // 位数
+	k    uint32 // 哈希函数个数
+	n    uint64 // 已经添加的key数量
+}
+
+// New 创建一个m位、k个哈希函数的过滤器
+func New(m uint64, k uint32) *Filter {
+	m, k = max(m, 1), max(k, 1)
+	return &Filter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// NewWithEstimates 创建一个装入n个key时误判率约为fp的过滤器
+func NewWithEstimates(n uint64, fp float64) *Filter {
+	return New(EstimateParameters(n, fp))
+}
+
+func (f *Filter) Add(key string) {
+	h1, h2 := hashes(key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := uint64(0); i < uint64(f.k); i++ {
+		idx := (h1 + i*h2) % f.m
+		f.bits[idx/64] |= 1 << (idx % 64)
+	}
+	f.n++
+}
+
+func (f *Filter) Test(key string) bool {
+	h1, h2 := hashes(key)
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for i := uint64(0); i < uint64(f.k); i++ {
+		idx := (h1 + i*h2) % f.m
+		if f.bits[idx/64]&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count 返回添加过的key数量，重复添加的key会被重复计数
+func (f *Filter) Count() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.n
+}
+
+// Merge 把other中的key合并进来，两个过滤器的m和k必须相同
+func (f *Filter) Merge(other *Filter) error {
+	if f == other {
+		return nil
+	}
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.m != other.m || f.k != other.k {
+		return fmt.Errorf("bloom: cannot merge filter m=%d k=%d into m=%d k=%d", other.m, other.k, f.m, f.k)
+	}
+	for i := range f.bits {
+		f.bits[i] |= other.bits[i]
+	}
+	f.n += other.n
+	return nil
+}
+
+// MarshalBinary 格式：类型(1字节) | k(4字节) | m(8字节) | n(8字节) | 位数组，整数都是大端序
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	buf := make([]byte, 0, 21+8*len(f.bits))
+	buf = append(buf, typeFilter)
+	buf = binary.BigEndian.AppendUint32(buf, f.k)
+	buf = binary.BigEndian.AppendUint64(buf, f.m)
+	buf = binary.BigEndian.AppendUint64(buf, f.n)
+	for _, word := range f.bits {
+		buf = binary.BigEndian.AppendUint64(buf, word)
+	}
+	return buf, nil
+}
+
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	if len(data) < 21 || data[0] != typeFilter {
+		return errCorrupt
+	}
+	k := binary.BigEndian.Uint32(data[1:])
+	m := binary.BigEndian.Uint64(data[5:])
+	n := binary.BigEndian.Uint64(data[13:])
+	data = data[21:]
+	// 先限制m不超过数据的位数，(m+63)才不会溢出
+	if k == 0 || m == 0 || m > uint64(len(data))*8 || uint64(len(data)) != (m+63)/64*8 {
+		return errCorrupt
+	}
+	bits := make([]uint64, len(data)/8)
+	for i := range bits {
+		bits[i] = binary.BigEndian.Uint64(data[i*8:])
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bits, f.m, f.k, f.n = bits, m, k, n
+	return nil
+}
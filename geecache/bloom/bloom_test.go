@@ -0,0 +1,132 @@
+package bloom
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+type filter interface {
+	Add(key string)
+	Test(key string) bool
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+var (
+	_ filter = (*Filter)(nil)
+	_ filter = (*CountingFilter)(nil)
+	_ filter = (*ScalableFilter)(nil)
+)
+
+// 添加n个key之后，检查没有漏判，并且另外n个key的误判率不超过maxFP
+func checkFilter(t *testing.T, f filter, n int, maxFP float64) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		f.Add(fmt.Sprintf("key%d", i))
+	}
+	for i := 0; i < n; i++ {
+		if !f.Test(fmt.Sprintf("key%d", i)) {
+			t.Fatalf("key%d was added but not found", i)
+		}
+	}
+	fp := 0
+	for i := 0; i < n; i++ {
+		if f.Test(fmt.Sprintf("absent%d", i)) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / float64(n); rate > maxFP {
+		t.Fatalf("false positive rate = %.4f, want <= %.4f", rate, maxFP)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	checkFilter(t, NewWithEstimates(10000, 0.01), 10000, 0.02)
+}
+
+func TestCountingFilter(t *testing.T) {
+	f := NewCountingWithEstimates(10000, 0.01)
+	checkFilter(t, f, 10000, 0.02)
+	if !f.Remove("key1") || f.Test("key1") {
+		t.Fatal("key1 should be removed")
+	}
+	if f.Remove("never-added-key") {
+		t.Fatal("removing an absent key should fail")
+	}
+	if f.Count() != 9999 {
+		t.Fatalf("count = %d, want 9999", f.Count())
+	}
+}
+
+func TestScalableFilter(t *testing.T) {
+	f := NewScalable(100, 0.01)
+	// 远超初始容量，过滤器要自动扩容
+	checkFilter(t, f, 10000, 0.02)
+	if len(f.filters) < 2 {
+		t.Fatalf("filters = %d, want growth", len(f.filters))
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	for _, pair := range []struct{ src, dst filter }{
+		{NewWithEstimates(1000, 0.01), &Filter{}},
+		{NewCountingWithEstimates(1000, 0.01), &CountingFilter{}},
+		{NewScalable(10, 0.01), &ScalableFilter{}},
+	} {
+		for i := 0; i < 100; i++ {
+			pair.src.Add(fmt.Sprintf("key%d", i))
+		}
+		data, err := pair.src.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pair.dst.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%T: %v", pair.dst, err)
+		}
+		for i := 0; i < 100; i++ {
+			if !pair.dst.Test(fmt.Sprintf("key%d", i)) {
+				t.Fatalf("%T: key%d lost after unmarshal", pair.dst, i)
+			}
+		}
+		if err := pair.dst.UnmarshalBinary(data[:len(data)-1]); err == nil {
+			t.Fatalf("%T: truncated data should fail", pair.dst)
+		}
+	}
+}
+
+// 头部中的大小不能用来越界或者分配超大的内存
+func TestUnmarshalCorrupt(t *testing.T) {
+	// m=^uint64(0)时(m+63)/64*8溢出成0，只有21字节头部
+	header := make([]byte, 21)
+	header[0] = typeFilter
+	binary.BigEndian.PutUint32(header[1:], 3)
+	binary.BigEndian.PutUint64(header[5:], ^uint64(0))
+	if err := (&Filter{}).UnmarshalBinary(header); err == nil {
+		t.Fatal("filter with overflowing m should fail")
+	}
+	// count远大于剩下的数据能放下的Filter个数
+	scalable := make([]byte, 21)
+	scalable[0] = typeScalable
+	binary.BigEndian.PutUint64(scalable[1:], 10)
+	binary.BigEndian.PutUint32(scalable[17:], ^uint32(0))
+	if err := (&ScalableFilter{}).UnmarshalBinary(scalable); err == nil {
+		t.Fatal("scalable filter with a huge count should fail")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a, b := New(1024, 4), New(1024, 4)
+	a.Add("Tom")
+	b.Add("Jack")
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Test("Tom") || !a.Test("Jack") {
+		t.Fatal("merged filter should contain both keys")
+	}
+	if err := a.Merge(New(512, 4)); err == nil {
+		t.Fatal("merging filters of different size should fail")
+	}
+}
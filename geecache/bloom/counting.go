@@ -0,0 +1,110 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// CountingFilter 的每一位是一个8位计数器，Add时加一，Remove时减一，所以可以删除key。
+// 计数器加到255之后不再变化，这个位置以后也不会再被减掉，只会多误判不会漏判
+type CountingFilter struct {
+	mu       sync.RWMutex
+	counters []uint8
+	m        uint64
+	k        uint32
+	n        uint64 // 当前的key数量
+}
+
+// NewCounting 创建一个m个计数器、k个哈希函数的过滤器
+func NewCounting(m uint64, k uint32) *CountingFilter {
+	m, k = max(m, 1), max(k, 1)
+	return &CountingFilter{counters: make([]uint8, m), m: m, k: k}
+}
+
+// NewCountingWithEstimates 创建一个装入n个key时误判率约为fp的过滤器
+func NewCountingWithEstimates(n uint64, fp float64) *CountingFilter {
+	return NewCounting(EstimateParameters(n, fp))
+}
+
+func (f *CountingFilter) Add(key string) {
+	h1, h2 := hashes(key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := uint64(0); i < uint64(f.k); i++ {
+		if idx := (h1 + i*h2) % f.m; f.counters[idx] < 255 {
+			f.counters[idx]++
+		}
+	}
+	f.n++
+}
+
+// Remove 删除一个添加过的key，key不在过滤器中时什么也不做并返回false。
+// 删除没有添加过但被误判存在的key会让其他key被漏判，调用方需要保证key确实添加过
+func (f *CountingFilter) Remove(key string) bool {
+	h1, h2 := hashes(key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.test(h1, h2) {
+		return false
+	}
+	for i := uint64(0); i < uint64(f.k); i++ {
+		if idx := (h1 + i*h2) % f.m; f.counters[idx] < 255 {
+			f.counters[idx]--
+		}
+	}
+	f.n--
+	return true
+}
+
+func (f *CountingFilter) Test(key string) bool {
+	h1, h2 := hashes(key)
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.test(h1, h2)
+}
+
+func (f *CountingFilter) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < uint64(f.k); i++ {
+		if f.counters[(h1+i*h2)%f.m] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count 返回当前的key数量
+func (f *CountingFilter) Count() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.n
+}
+
+// MarshalBinary 格式：类型(1字节) | k(4字节) | m(8字节) | n(8字节) | 计数器数组
+func (f *CountingFilter) MarshalBinary() ([]byte, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	buf := make([]byte, 0, 21+len(f.counters))
+	buf = append(buf, typeCounting)
+	buf = binary.BigEndian.AppendUint32(buf, f.k)
+	buf = binary.BigEndian.AppendUint64(buf, f.m)
+	buf = binary.BigEndian.AppendUint64(buf, f.n)
+	buf = append(buf, f.counters...)
+	return buf, nil
+}
+
+func (f *CountingFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 21 || data[0] != typeCounting {
+		return errCorrupt
+	}
+	k := binary.BigEndian.Uint32(data[1:])
+	m := binary.BigEndian.Uint64(data[5:])
+	n := binary.BigEndian.Uint64(data[13:])
+	data = data[21:]
+	if k == 0 || m == 0 || uint64(len(data)) != m {
+		return errCorrupt
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counters, f.m, f.k, f.n = append([]uint8(nil), data...), m, k, n
+	return nil
+}
@@ -0,0 +1,132 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// ScalableFilter 由一串Filter组成，最后一个装满时追加一个容量翻倍、误判率减半的Filter，
+// 总的误判率不会超过fp (fp/2 + fp/4 + ...)
+type ScalableFilter struct {
+	mu      sync.RWMutex
+	filters []*Filter
+	initial uint64  // 第一个Filter的容量
+	fp      float64 // 期望的总误判率
+}
+
+// NewScalable 创建一个初始容量为initial、总误判率约为fp的过滤器
+func NewScalable(initial uint64, fp float64) *ScalableFilter {
+	s := &ScalableFilter{initial: max(initial, 1), fp: fp}
+	s.grow()
+	return s
+}
+
+// 第i个Filter的容量
+func (s *ScalableFilter) capacity(i int) uint64 {
+	return s.initial << i
+}
+
+func (s *ScalableFilter) grow() {
+	i := len(s.filters)
+	s.filters = append(s.filters, NewWithEstimates(s.capacity(i), s.fp*math.Pow(0.5, float64(i+1))))
+}
+
+// Add 添加key，已经可能存在的key不会重复添加，避免白白占用容量
+func (s *ScalableFilter) Add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.test(key) {
+		return
+	}
+	last := len(s.filters) - 1
+	if s.filters[last].Count() >= s.capacity(last) {
+		s.grow()
+		last++
+	}
+	s.filters[last].Add(key)
+}
+
+func (s *ScalableFilter) Test(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.test(key)
+}
+
+func (s *ScalableFilter) test(key string) bool {
+	for _, f := range s.filters {
+		if f.Test(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count 返回添加过的key数量
+func (s *ScalableFilter) Count() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var n uint64
+	for _, f := range s.filters {
+		n += f.Count()
+	}
+	return n
+}
+
+// MarshalBinary 格式：类型(1字节) | initial(8字节) | fp(8字节) | Filter个数(4字节) |
+// 每个Filter的长度(4字节)和它自己的序列化结果
+func (s *ScalableFilter) MarshalBinary() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	buf := []byte{typeScalable}
+	buf = binary.BigEndian.AppendUint64(buf, s.initial)
+	buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(s.fp))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(s.filters)))
+	for _, f := range s.filters {
+		data, err := f.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+		buf = append(buf, data...)
+	}
+	return buf, nil
+}
+
+func (s *ScalableFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 21 || data[0] != typeScalable {
+		return errCorrupt
+	}
+	initial := binary.BigEndian.Uint64(data[1:])
+	fp := math.Float64frombits(binary.BigEndian.Uint64(data[9:]))
+	count := binary.BigEndian.Uint32(data[17:])
+	data = data[21:]
+	// 每个Filter至少有4字节长度、21字节头部和8字节位图，count不能超过剩下的数据能放下的个数
+	if initial == 0 || count == 0 || uint64(count) > uint64(len(data))/(4+21+8) {
+		return errCorrupt
+	}
+	filters := make([]*Filter, 0, count)
+	for i := uint32(0); i < count; i++ {
+		if len(data) < 4 {
+			return errCorrupt
+		}
+		size := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if uint64(len(data)) < uint64(size) {
+			return errCorrupt
+		}
+		f := &Filter{}
+		if err := f.UnmarshalBinary(data[:size]); err != nil {
+			return err
+		}
+		filters = append(filters, f)
+		data = data[size:]
+	}
+	if len(data) != 0 {
+		return errCorrupt
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filters, s.initial, s.fp = filters, initial, fp
+	return nil
+}
@@ -0,0 +1,136 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 表示远程节点的熔断器处于打开状态，请求没有发出去
+var ErrCircuitOpen = errors.New("geecache: circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // 正常放行
+	breakerOpen                         // 连续失败太多次，直接拒绝
+	breakerHalfOpen                     // 冷却结束，放一个请求试探节点是否恢复
+)
+
+// circuitBreaker 是每个远程节点的熔断器：连续失败threshold次后打开，
+// cooldown之后进入半开状态，只放行一个试探请求，成功则关闭，失败则重新打开。
+// nil表示不启用熔断
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int       // 连续失败的次数
+	openedAt time.Time // 最近一次打开的时间
+	probing  bool      // 半开状态下是否已经有试探请求在进行
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow 返回这次请求是否可以发出去
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// available 和allow一样判断节点是否可用，但不占用半开状态的试探机会，用于挑选节点
+func (b *circuitBreaker) available() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		return time.Since(b.openedAt) >= b.cooldown
+	case breakerHalfOpen:
+		return !b.probing
+	}
+	return true
+}
+
+// record 记录一次请求的结果，failed表示是节点本身的问题
+func (b *circuitBreaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !failed {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// cancel 在调用方放弃请求时调用，不计入成功或失败，只归还试探机会
+func (b *circuitBreaker) cancel() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// retryPolicy 控制失败之后的重试，零值表示不重试
+type retryPolicy struct {
+	retries int           // 最多重试几次
+	backoff time.Duration // 第一次重试前的等待时间，之后每次翻倍
+}
+
+// 第attempt次重试前等待的时间，加上随机抖动，避免所有客户端同时重试
+func (r retryPolicy) delay(attempt int) time.Duration {
+	d := r.backoff << attempt
+	return d/2 + rand.N(d/2+1)
+}
+
+// 等待d，ctx被取消时提前返回false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
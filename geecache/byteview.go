@@ -1,8 +1,16 @@
 package geecache
 
+import (
+	"fmt"
+	"time"
+)
+
 type ByteView struct {
 	b []byte // read only
 	// use byets to support image,video,etc..
+	e time.Time // 过期时间，零值表示永不过期
+	// 负缓存：key在数据源中不存在，b为空
+	notFound bool
 }
 
 // 实现Len()方法,ByteView就能当做value传入lru中了
@@ -23,6 +31,16 @@ func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
 }
 
+// 返回过期时间，零值表示永不过期
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+// 在now时是否已经过期
+func (v ByteView) expired(now time.Time) bool {
+	return !v.e.IsZero() && !now.Before(v.e)
+}
+
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
@@ -32,3 +50,11 @@ func cloneBytes(b []byte) []byte {
 func (v ByteView) String() string {
 	return string(v.b)
 }
+
+// 缓存中的负缓存记录转换为ErrNotFound
+func (v ByteView) result(key string) (ByteView, error) {
+	if v.notFound {
+		return ByteView{}, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return v, nil
+}
@@ -1,33 +1,142 @@
 package geecache
 
 import (
+	"mikucache/geecache/eviction"
 	"mikucache/geecache/lru"
 	"sync"
+	"time"
 )
 
+// localCache 是Group的本地缓存，cache和shardedCache都实现了它
+type localCache interface {
+	add(key string, value ByteView)
+	get(key string) (ByteView, bool)
+	remove(key string)
+	removeExpired() int
+	stats() CacheStats
+	// 按淘汰的先后顺序返回所有没有过期的记录，淘汰策略没有实现eviction.Ranger时返回false
+	entries() ([]cacheEntry, bool)
+}
+
+type cacheEntry struct {
+	key   string
+	value ByteView
+}
+
+// shards<=1时返回一个cache，否则返回有shards个分片的shardedCache
+func newLocalCache(cacheBytes int64, shards int, newPolicy eviction.Factory, onEvicted func(string, ByteView, lru.EvictReason)) localCache {
+	if shards <= 1 {
+		return &cache{cacheBytes: cacheBytes, newPolicy: newPolicy, onEvicted: onEvicted}
+	}
+	return newShardedCache(cacheBytes, shards, newPolicy, onEvicted)
+}
+
 type cache struct {
-	mu         sync.Mutex // 保证并发安全
-	lru        *lru.Cache // 缓存的核心数据结构
-	cacheBytes int64      // 缓存的内存
+	mu         sync.Mutex       // 保证并发安全
+	policy     eviction.Policy  // 缓存的核心数据结构
+	newPolicy  eviction.Factory // 创建policy，为nil时使用LRU
+	cacheBytes int64            // 缓存的内存
+	// 可选的，记录被清除时调用
+	onEvicted func(key string, value ByteView, reason lru.EvictReason)
+	nget      int64 // 以下统计数据由mu保护
+	nhit      int64
+	nevict    int64
 }
 
 func (c *cache) add(key string, value ByteView) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil) //Lazy Initialization
+	if c.policy == nil {
+		newPolicy := c.newPolicy
+		if newPolicy == nil {
+			newPolicy = eviction.NewLRU
+		}
+		c.policy = newPolicy(c.cacheBytes, c.evicted) //Lazy Initialization
 	}
-	c.lru.Add(key, value)
+	c.policy.AddWithExpire(key, value, value.Expire())
 }
 
 func (c *cache) get(key string) (ByteView, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
+	c.nget++
+	if c.policy == nil {
 		return ByteView{}, false
 	}
-	if v, ok := c.lru.Get(key); ok {
+	if v, ok := c.policy.Get(key); ok {
+		c.nhit++
 		return v.(ByteView), ok
 	}
 	return ByteView{}, false
 }
+
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy == nil {
+		return
+	}
+	c.policy.Remove(key)
+}
+
+// 清除所有过期的记录
+func (c *cache) removeExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy == nil {
+		return 0
+	}
+	return c.policy.RemoveExpired()
+}
+
+func (c *cache) entries() ([]cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy == nil {
+		return nil, true
+	}
+	r, ok := c.policy.(eviction.Ranger)
+	if !ok {
+		return nil, false
+	}
+	entries := make([]cacheEntry, 0, c.policy.Len())
+	r.Range(func(key string, value lru.Value, expire time.Time) bool {
+		entries = append(entries, cacheEntry{key, value.(ByteView)})
+		return true
+	})
+	return entries, true
+}
+
+// 后台定期清理过期记录，避免过期但一直没有被访问的记录占着内存
+func janitor(c localCache, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.removeExpired()
+	}
+}
+
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := CacheStats{
+		Gets:      c.nget,
+		Hits:      c.nhit,
+		Evictions: c.nevict,
+	}
+	if c.policy != nil {
+		s.Bytes = c.policy.Bytes()
+		s.Items = int64(c.policy.Len())
+	}
+	return s
+}
+
+// policy的OnEvicted回调，调用时已经持有c.mu
+func (c *cache) evicted(key string, value lru.Value, reason lru.EvictReason) {
+	if reason != lru.EvictRemoved {
+		c.nevict++
+	}
+	if c.onEvicted != nil {
+		c.onEvicted(key, value.(ByteView), reason)
+	}
+}
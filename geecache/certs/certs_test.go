@@ -0,0 +1,96 @@
+package certs
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// 用两份配置建立一次TLS连接，返回双方握手的错误
+func handshake(t *testing.T, server, client *tls.Config) (serverErr, clientErr error) {
+	t.Helper()
+	c1, c2 := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		conn := tls.Server(c1, server)
+		err := conn.Handshake()
+		conn.Close()
+		done <- err
+	}()
+	conn := tls.Client(c2, client)
+	clientErr = conn.Handshake()
+	if clientErr == nil {
+		// 服务端拒绝客户端证书时，客户端在第一次读取时才会收到错误
+		_, clientErr = conn.Read(make([]byte, 1))
+		if clientErr == io.EOF {
+			clientErr = nil
+		}
+	}
+	conn.Close()
+	return <-done, clientErr
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca, err := NewCA("test-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ca.Config("node-a", "localhost", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := ca.Config("node-b", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.ServerName = "127.0.0.1"
+	if serverErr, clientErr := handshake(t, server, client); serverErr != nil || clientErr != nil {
+		t.Fatalf("handshake: server %v, client %v", serverErr, clientErr)
+	}
+
+	// 另一个CA签发的客户端证书会被拒绝
+	other, _ := NewCA("other-ca")
+	stranger, _ := other.Issue("stranger")
+	client.Certificates = []tls.Certificate{stranger}
+	if serverErr, _ := handshake(t, server, client); serverErr == nil {
+		t.Fatal("server accepted a certificate from another CA")
+	}
+	// 没有客户端证书也会被拒绝
+	client.Certificates = nil
+	if serverErr, _ := handshake(t, server, client); serverErr == nil {
+		t.Fatal("server accepted a client without certificate")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := NewCA("test-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ca.Issue("node-a", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile, caFile := filepath.Join(dir, "node.pem"), filepath.Join(dir, "node-key.pem"), filepath.Join(dir, "ca.pem")
+	if err = WriteKeyPair(cert, certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err = ca.WriteCA(caFile); err != nil {
+		t.Fatal(err)
+	}
+	server, err := LoadConfig(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _ := ca.Config("node-b")
+	client.ServerName = "localhost"
+	if serverErr, clientErr := handshake(t, server, client); serverErr != nil || clientErr != nil {
+		t.Fatalf("handshake: server %v, client %v", serverErr, clientErr)
+	}
+	if _, err = LoadConfig(certFile, keyFile, certFile+".missing"); err == nil {
+		t.Fatal("LoadConfig with a missing CA file should fail")
+	}
+}
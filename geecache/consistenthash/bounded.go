@@ -0,0 +1,85 @@
+package consistenthash
+
+import "math"
+
+// Bounded 是有界负载的一致性哈希 (Mirrokni et al., 2016)：在哈希环的基础上，
+// 每个节点最多负责平均负载的c倍，key原本的节点满了时顺时针找下一个没满的节点。
+// 负载是当前分配出去、还没有Release的key的数量，同一个key在Release之前总是分配到同一个节点
+type Bounded struct {
+	ring     *Map
+	c        float64
+	loads    map[string]int    // 节点 -> 分配给它的key数量
+	assigned map[string]string // key -> 节点
+}
+
+// NewBounded 创建一个负载上限系数为c的Bounded，c小于1时按1处理，replicas和fn的含义和New一样
+func NewBounded(replicas int, c float64, fn Hash) *Bounded {
+	return &Bounded{
+		ring:     New(replicas, fn),
+		c:        max(c, 1),
+		loads:    make(map[string]int),
+		assigned: make(map[string]string),
+	}
+}
+
+func (b *Bounded) Add(nodes ...string) {
+	for _, node := range nodes {
+		if _, ok := b.loads[node]; !ok {
+			b.loads[node] = 0
+			b.ring.Add(node)
+		}
+	}
+}
+
+// Remove 删除节点，分配给它们的key会在下次Get时重新分配
+func (b *Bounded) Remove(nodes ...string) {
+	removed := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		if _, ok := b.loads[node]; ok {
+			removed[node] = true
+			delete(b.loads, node)
+			b.ring.Remove(node)
+		}
+	}
+	for key, node := range b.assigned {
+		if removed[node] {
+			delete(b.assigned, key)
+		}
+	}
+}
+
+// Get 返回key分配到的节点，还没有分配时选择环上第一个负载没到上限的节点
+func (b *Bounded) Get(key string) string {
+	if node, ok := b.assigned[key]; ok {
+		return node
+	}
+	if len(b.loads) == 0 {
+		return ""
+	}
+	// c>=1时所有节点的上限之和大于已分配的key数量，一定能找到节点
+	limit := int(math.Ceil(b.c * float64(len(b.assigned)+1) / float64(len(b.loads))))
+	var node string
+	b.ring.Walk(key, func(n string) bool {
+		if b.loads[n] < limit {
+			node = n
+			return false
+		}
+		return true
+	})
+	b.assigned[key] = node
+	b.loads[node]++
+	return node
+}
+
+// Release 释放key，它占用的负载被归还给节点
+func (b *Bounded) Release(key string) {
+	if node, ok := b.assigned[key]; ok {
+		delete(b.assigned, key)
+		b.loads[node]--
+	}
+}
+
+// Load 返回当前分配给node的key数量
+func (b *Bounded) Load(node string) int {
+	return b.loads[node]
+}
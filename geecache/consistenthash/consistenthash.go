@@ -1,7 +1,9 @@
 package consistenthash
 
 import (
+	"cmp"
 	"hash/crc32"
+	"slices"
 	"sort"
 	"strconv"
 )
@@ -11,15 +13,21 @@ type Hash func(data []byte) uint32
 type Map struct {
 	hash     Hash           // hash函数
 	replicas int            // 虚拟节点倍数
-	keys     []int          // map keys
-	hashMap  map[int]string // hashMap
+	ring     []vnode        // 按(hash, node)排序的虚拟节点
+	weights  map[string]int // 节点 -> 权重
+}
+
+// 虚拟节点
+type vnode struct {
+	hash uint32
+	node string
 }
 
 func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
+		weights:  make(map[string]int),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -27,30 +35,116 @@ func New(replicas int, fn Hash) *Map {
 	return m
 }
 
-// 添加节点
+// 添加节点，权重都是1
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			// fmt.Println("hash result: ", hash)
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		m.addWeighted(key, 1)
+	}
+	m.sort()
+}
+
+// AddWeighted 添加一个权重为weight的节点，它有replicas*weight个虚拟节点，
+// 负责的key也大约是权重为1的节点的weight倍。weight小于1时按1处理，节点已经存在时修改它的权重
+func (m *Map) AddWeighted(node string, weight int) {
+	weight = max(weight, 1)
+	if m.weights[node] == weight {
+		return
+	}
+	if _, ok := m.weights[node]; ok {
+		m.Remove(node)
+	}
+	m.addWeighted(node, weight)
+	m.sort()
+}
+
+func (m *Map) addWeighted(node string, weight int) {
+	if _, ok := m.weights[node]; ok {
+		return
+	}
+	m.weights[node] = weight
+	// 第i个虚拟节点的位置只和i有关，增加权重时原来的虚拟节点位置不变
+	for i := 0; i < m.replicas*weight; i++ {
+		m.ring = append(m.ring, vnode{hash: m.hash([]byte(strconv.Itoa(i) + node)), node: node})
+	}
+}
+
+// 哈希值相同的虚拟节点按节点名排序，这样冲突时选中哪个节点和添加的顺序无关
+func (m *Map) sort() {
+	slices.SortFunc(m.ring, func(a, b vnode) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.node, b.node))
+	})
+}
+
+// Weight 返回节点的权重，节点不存在时返回0
+func (m *Map) Weight(node string) int {
+	return m.weights[node]
+}
+
+// 删除节点，只会影响原来落在这些节点上的key
+func (m *Map) Remove(keys ...string) {
+	removed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if _, ok := m.weights[key]; ok {
+			removed[key] = true
+			delete(m.weights, key)
 		}
 	}
-	sort.Ints(m.keys)
-	// fmt.Println("m.keys: ", m.keys)
+	if len(removed) == 0 {
+		return
+	}
+	// 原地过滤掉被删除节点的虚拟节点，m.ring仍然有序
+	m.ring = slices.DeleteFunc(m.ring, func(v vnode) bool {
+		return removed[v.node]
+	})
+}
+
+// 返回key落在的第一个虚拟节点的下标
+func (m *Map) search(key string) int {
+	hash := m.hash([]byte(key))
+	idx := sort.Search(len(m.ring), func(i int) bool {
+		return m.ring[i].hash >= hash
+	})
+	return idx % len(m.ring)
 }
 
 // 选择节点,返回key要存到的节点
 func (m *Map) Get(key string) string {
-	if len(m.keys) == 0 {
+	if len(m.ring) == 0 {
 		return ""
 	}
-	hash := int(m.hash([]byte(key)))
-	idx := sort.Search(len(m.keys), func(i int) bool {
-		return m.keys[i] >= hash
+	return m.ring[m.search(key)].node
+}
+
+// Walk 从key所在的位置开始顺时针遍历哈希环，依次把每个不同的节点传给fn，fn返回false时停止。
+// 第一个节点就是Get(key)的结果，后面的节点可以在它不可用时作为备选
+func (m *Map) Walk(key string, fn func(node string) bool) {
+	if len(m.ring) == 0 {
+		return
+	}
+	idx := m.search(key)
+	seen := make(map[string]bool)
+	for i := 0; i < len(m.ring) && len(seen) < len(m.weights); i++ {
+		node := m.ring[(idx+i)%len(m.ring)].node
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		if !fn(node) {
+			return
+		}
+	}
+}
+
+// GetN 返回顺时针方向上负责key的前n个不同的节点，节点不足n个时返回所有节点。
+// 第一个节点就是Get(key)的结果，其余的是它的副本节点
+func (m *Map) GetN(key string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	nodes := make([]string, 0, n)
+	m.Walk(key, func(node string) bool {
+		nodes = append(nodes, node)
+		return len(nodes) < n
 	})
-	// fmt.Println("idx: ", idx)
-	// fmt.Println(m.hashMap)
-	return m.hashMap[m.keys[idx%len(m.keys)]]
+	return nodes
 }
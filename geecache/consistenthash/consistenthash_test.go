@@ -1,6 +1,8 @@
 package consistenthash
 
 import (
+	"hash/fnv"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -13,3 +15,127 @@ func TestHashing(t *testing.T) {
 	hash.Add("6", "4", "2")
 	t.Log("最终选择的节点：", hash.Get("10"))
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 虚拟节点: 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+	if got := hash.Get("23"); got != "4" {
+		t.Fatalf("Get(23) = %s, want 4", got)
+	}
+	hash.Remove("4")
+	// 4的虚拟节点被删除之后，23落在26上
+	if got := hash.Get("23"); got != "6" {
+		t.Fatalf("Get(23) after remove = %s, want 6", got)
+	}
+	// 其他节点上的key不受影响
+	if got := hash.Get("11"); got != "2" {
+		t.Fatalf("Get(11) after remove = %s, want 2", got)
+	}
+	hash.Remove("6", "2")
+	if got := hash.Get("11"); got != "" {
+		t.Fatalf("Get(11) on empty ring = %s, want empty", got)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 虚拟节点: 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+	var nodes []string
+	hash.Walk("23", func(node string) bool {
+		nodes = append(nodes, node)
+		return true
+	})
+	if want := []string{"4", "6", "2"}; !reflect.DeepEqual(nodes, want) {
+		t.Fatalf("Walk(23) = %v, want %v", nodes, want)
+	}
+	nodes = nodes[:0]
+	hash.Walk("27", func(node string) bool {
+		nodes = append(nodes, node)
+		return len(nodes) < 2
+	})
+	if want := []string{"2", "4"}; !reflect.DeepEqual(nodes, want) {
+		t.Fatalf("Walk(27) stopped = %v, want %v", nodes, want)
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2")
+	cases := []struct {
+		key  string
+		n    int
+		want []string
+	}{
+		{"11", 2, []string{"2", "4"}},
+		{"23", 1, []string{"4"}},
+		{"27", 3, []string{"2", "4", "6"}},
+		{"27", 5, []string{"2", "4", "6"}}, // 节点不足n个
+		{"27", 0, nil},
+	}
+	for _, c := range cases {
+		if got := hash.GetN(c.key, c.n); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("GetN(%s, %d) = %v, want %v", c.key, c.n, got, c.want)
+		}
+		if c.n > 0 && hash.GetN(c.key, c.n)[0] != hash.Get(c.key) {
+			t.Errorf("GetN(%s)[0] != Get(%s)", c.key, c.key)
+		}
+	}
+}
+
+func TestAddWeighted(t *testing.T) {
+	// 只有两个节点时crc32的分布偏差太大，这里用fnv
+	hash := New(50, func(key []byte) uint32 {
+		h := fnv.New32a()
+		h.Write(key)
+		return h.Sum32()
+	})
+	hash.AddWeighted("big", 3)
+	hash.Add("small")
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[hash.Get("key-"+strconv.Itoa(i))]++
+	}
+	// big的虚拟节点是small的3倍，大约负责3/4的key
+	if share := float64(counts["big"]) / 10000; share < 0.65 || share > 0.85 {
+		t.Fatalf("big owns %.2f of keys, want about 0.75", share)
+	}
+
+	// 修改权重之后虚拟节点数量跟着变化，再改回来结果和原来一样
+	before := hash.Get("Tom")
+	hash.AddWeighted("big", 1)
+	if hash.Weight("big") != 1 || len(hash.ring) != 100 {
+		t.Fatalf("weight = %d, vnodes = %d after reweight", hash.Weight("big"), len(hash.ring))
+	}
+	hash.AddWeighted("big", 3)
+	if got := hash.Get("Tom"); got != before {
+		t.Fatalf("Get(Tom) = %s after restoring weight, want %s", got, before)
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// 所有虚拟节点的哈希值都相同
+	collide := func(key []byte) uint32 { return 7 }
+	a, b := New(3, collide), New(3, collide)
+	a.Add("x", "y")
+	b.Add("y", "x")
+	// 冲突时按节点名决定，和添加顺序无关
+	if a.Get("Tom") != "x" || b.Get("Tom") != "x" {
+		t.Fatalf("Get(Tom) = %s, %s, want x", a.Get("Tom"), b.Get("Tom"))
+	}
+	// 删除x不会影响y的虚拟节点
+	a.Remove("x")
+	if got := a.Get("Tom"); got != "y" {
+		t.Fatalf("Get(Tom) after removing x = %s, want y", got)
+	}
+}
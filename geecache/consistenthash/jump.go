@@ -0,0 +1,45 @@
+package consistenthash
+
+import "slices"
+
+// Jump 是Jump Consistent Hash (Lamping & Veach, 2014)：不需要虚拟节点，
+// 几乎不占内存，分布非常均匀，但节点只能按编号使用，
+// 只有在末尾增删节点时才是最小迁移，删除中间的节点会让它之后的节点都发生变化
+type Jump struct {
+	nodes []string
+}
+
+func NewJump() *Jump {
+	return &Jump{}
+}
+
+// Add 把新节点追加到末尾，已经存在的节点会被忽略
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		if !slices.Contains(j.nodes, node) {
+			j.nodes = append(j.nodes, node)
+		}
+	}
+}
+
+func (j *Jump) Remove(nodes ...string) {
+	j.nodes = removeNodes(j.nodes, nodes)
+}
+
+func (j *Jump) Get(key string) string {
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	return j.nodes[jumpHash(hash64(key), len(j.nodes))]
+}
+
+// 论文中的算法：把key映射到[0, buckets)，buckets增加1时只有1/(buckets+1)的key会移动到新的桶
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,96 @@
+package consistenthash
+
+import "slices"
+
+// Maglev 表的默认大小，需要是质数并且远大于节点数
+const defaultMaglevSize = 65537
+
+// Maglev 是Google Maglev负载均衡器使用的哈希 (Eisenbud et al., 2016)：
+// 每个节点按自己的排列轮流占据查找表中的槽位，Get只需要查一次表。
+// 分布几乎完全均匀，增删节点时迁移的key比哈希环稍多，每次变化都要重建整张表
+type Maglev struct {
+	size  uint64
+	nodes []string // 按名字排序，保证结果和添加顺序无关
+	table []int    // 槽位 -> nodes的下标
+}
+
+// NewMaglev 创建一个查找表大小为size的Maglev，size不是质数时向上取最近的质数，0表示使用默认大小
+func NewMaglev(size uint64) *Maglev {
+	if size == 0 {
+		size = defaultMaglevSize
+	}
+	for !isPrime(size) {
+		size++
+	}
+	return &Maglev{size: size}
+}
+
+func (m *Maglev) Add(nodes ...string) {
+	for _, node := range nodes {
+		if i, found := slices.BinarySearch(m.nodes, node); !found {
+			m.nodes = slices.Insert(m.nodes, i, node)
+		}
+	}
+	m.populate()
+}
+
+func (m *Maglev) Remove(nodes ...string) {
+	m.nodes = removeNodes(m.nodes, nodes)
+	m.populate()
+}
+
+func (m *Maglev) Get(key string) string {
+	if len(m.nodes) == 0 {
+		return ""
+	}
+	return m.nodes[m.table[hash64(key)%m.size]]
+}
+
+// 重建查找表：节点i的排列是 (offset + j*skip) % size，skip与size互质，所以排列会遍历所有槽位。
+// 节点轮流取自己排列中下一个空槽位，直到填满整张表
+func (m *Maglev) populate() {
+	if len(m.nodes) == 0 {
+		m.table = nil
+		return
+	}
+	n := len(m.nodes)
+	offsets := make([]uint64, n)
+	skips := make([]uint64, n)
+	next := make([]uint64, n)
+	for i, node := range m.nodes {
+		h := hash64(node)
+		offsets[i] = h % m.size
+		skips[i] = fmix64(h)%(m.size-1) + 1
+	}
+	table := make([]int, m.size)
+	for i := range table {
+		table[i] = -1
+	}
+	for filled := uint64(0); ; {
+		for i := 0; i < n; i++ {
+			c := (offsets[i] + next[i]*skips[i]) % m.size
+			for table[c] >= 0 {
+				next[i]++
+				c = (offsets[i] + next[i]*skips[i]) % m.size
+			}
+			table[c] = i
+			next[i]++
+			if filled++; filled == m.size {
+				m.table = table
+				return
+			}
+		}
+	}
+}
+
+func isPrime(n uint64) bool {
+	if n < 2 {
+		return false
+	}
+	for i := uint64(2); i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package consistenthash
+
+import "hash/fnv"
+
+// Picker 根据key选择负责它的节点，Map和本包中的其他算法都实现了它。
+// 和Map一样，所有实现都不是并发安全的，由调用方加锁
+type Picker interface {
+	// 添加节点
+	Add(nodes ...string)
+	// 删除节点
+	Remove(nodes ...string)
+	// 返回负责key的节点，没有节点时返回空字符串
+	Get(key string) string
+}
+
+var (
+	_ Picker = (*Map)(nil)
+	_ Picker = (*Jump)(nil)
+	_ Picker = (*Rendezvous)(nil)
+	_ Picker = (*Maglev)(nil)
+	_ Picker = (*Bounded)(nil)
+)
+
+// 把parts依次拼接后计算64位哈希：先fnv-1a，再用murmur3的fmix64打散，这样低位也足够均匀
+func hash64(parts ...string) uint64 {
+	h := fnv.New64a()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0}) // 分隔符，避免("ab","c")和("a","bc")哈希相同
+	}
+	return fmix64(h.Sum64())
+}
+
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+// 从nodes中删除所有出现在removed中的节点，保持原来的顺序
+func removeNodes(nodes []string, removed []string) []string {
+	drop := make(map[string]bool, len(removed))
+	for _, node := range removed {
+		drop[node] = true
+	}
+	keep := nodes[:0]
+	for _, node := range nodes {
+		if !drop[node] {
+			keep = append(keep, node)
+		}
+	}
+	return keep
+}
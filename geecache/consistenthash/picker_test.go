@@ -0,0 +1,178 @@
+package consistenthash
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// 以下是比较各种Picker的测试工具：键的分布是否均匀，以及增删节点时有多少key换了节点
+
+var pickers = []struct {
+	name string
+	new  func() Picker
+	cv   float64 // 允许的最大变异系数(标准差/平均值)
+}{
+	// crc32加50个虚拟节点的哈希环分布并不均匀，10个节点时最多的节点约是平均值的1.5倍
+	{"ring", func() Picker { return New(defaultTestReplicas, nil) }, 0.35},
+	{"jump", func() Picker { return NewJump() }, 0.05},
+	{"rendezvous", func() Picker { return NewRendezvous() }, 0.05},
+	{"maglev", func() Picker { return NewMaglev(0) }, 0.05},
+	{"bounded", func() Picker { return NewBounded(defaultTestReplicas, 1.25, nil) }, 0.25},
+}
+
+const defaultTestReplicas = 50
+
+func testNodes(n int) []string {
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("10.0.0.%d:8001", i)
+	}
+	return nodes
+}
+
+func testKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	return keys
+}
+
+// 用节点nodes新建一个Picker，返回每个key分到的节点
+func assign(newPicker func() Picker, nodes, keys []string) []string {
+	p := newPicker()
+	p.Add(nodes...)
+	owners := make([]string, len(keys))
+	for i, key := range keys {
+		owners[i] = p.Get(key)
+	}
+	return owners
+}
+
+// 每个节点分到的key数量的变异系数，以及最多的节点是平均值的几倍
+func distribution(owners []string, nodes []string) (cv, peak float64) {
+	counts := make(map[string]int, len(nodes))
+	for _, owner := range owners {
+		counts[owner]++
+	}
+	mean := float64(len(owners)) / float64(len(nodes))
+	var sum, most float64
+	for _, node := range nodes {
+		d := float64(counts[node]) - mean
+		sum += d * d
+		most = max(most, float64(counts[node]))
+	}
+	return math.Sqrt(sum/float64(len(nodes))) / mean, most / mean
+}
+
+// 两次分配之间换了节点的key的比例
+func remapRate(before, after []string) float64 {
+	moved := 0
+	for i := range before {
+		if before[i] != after[i] {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(before))
+}
+
+func TestPickerEmpty(t *testing.T) {
+	for _, p := range pickers {
+		picker := p.new()
+		if got := picker.Get("Tom"); got != "" {
+			t.Errorf("%s: Get on empty picker = %q", p.name, got)
+		}
+		picker.Add("a", "b")
+		picker.Remove("a", "b")
+		if got := picker.Get("Tom"); got != "" {
+			t.Errorf("%s: Get after removing all nodes = %q", p.name, got)
+		}
+	}
+}
+
+func TestPickerAddRemove(t *testing.T) {
+	for _, p := range pickers {
+		picker := p.new()
+		picker.Add("a", "b", "c")
+		picker.Add("b") // 重复添加不影响结果
+		picker.Remove("b")
+		for _, key := range testKeys(100) {
+			if got := picker.Get(key); got != "a" && got != "c" {
+				t.Fatalf("%s: Get(%s) = %q after removing b", p.name, key, got)
+			}
+		}
+	}
+}
+
+func TestPickerDistribution(t *testing.T) {
+	nodes, keys := testNodes(10), testKeys(100000)
+	for _, p := range pickers {
+		cv, peak := distribution(assign(p.new, nodes, keys), nodes)
+		t.Logf("%-10s cv=%.4f peak=%.3f", p.name, cv, peak)
+		if cv > p.cv {
+			t.Errorf("%s: cv = %.4f, want <= %.2f", p.name, cv, p.cv)
+		}
+	}
+}
+
+func TestPickerRemap(t *testing.T) {
+	nodes, keys := testNodes(11), testKeys(100000)
+	for _, p := range pickers {
+		base := assign(p.new, nodes[:10], keys)
+		added := remapRate(base, assign(p.new, nodes, keys))
+		removedLast := remapRate(base, assign(p.new, nodes[:9], keys))
+		removedFirst := remapRate(base, assign(p.new, nodes[1:10], keys))
+		t.Logf("%-10s add=%.4f remove-last=%.4f remove-first=%.4f", p.name, added, removedLast, removedFirst)
+		// 理想情况下增加第11个节点时移动1/11的key，删除一个节点时移动1/10的key
+		if added > 0.2 || removedLast > 0.2 {
+			t.Errorf("%s: add remap = %.4f, remove remap = %.4f, want <= 0.2", p.name, added, removedLast)
+		}
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	b := NewBounded(defaultTestReplicas, 1.25, nil)
+	nodes := testNodes(5)
+	b.Add(nodes...)
+	keys := testKeys(10000)
+	for _, key := range keys {
+		b.Get(key)
+	}
+	limit := int(math.Ceil(1.25 * float64(len(keys)) / float64(len(nodes))))
+	for _, node := range nodes {
+		if b.Load(node) > limit {
+			t.Fatalf("load of %s = %d, want <= %d", node, b.Load(node), limit)
+		}
+	}
+	// 已经分配的key不会因为负载变化而换节点
+	owner := b.Get(keys[0])
+	for _, key := range keys[1:] {
+		b.Release(key)
+	}
+	if got := b.Get(keys[0]); got != owner {
+		t.Fatalf("Get(%s) = %s, want %s", keys[0], got, owner)
+	}
+	b.Release(keys[0])
+	for _, node := range nodes {
+		if b.Load(node) != 0 {
+			t.Fatalf("load of %s = %d after releasing all keys", node, b.Load(node))
+		}
+	}
+}
+
+func BenchmarkPickerGet(b *testing.B) {
+	for _, n := range []int{10, 100} {
+		nodes, keys := testNodes(n), testKeys(1024)
+		for _, p := range pickers {
+			b.Run(fmt.Sprintf("%s/%d", p.name, n), func(b *testing.B) {
+				picker := p.new()
+				picker.Add(nodes...)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					picker.Get(keys[i%len(keys)])
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package consistenthash
+
+import "slices"
+
+// Rendezvous 是最高随机权重(HRW)哈希：每个节点对key打分，选分数最高的节点。
+// 增删任何节点都只影响落在这个节点上的key，代价是Get需要遍历所有节点
+type Rendezvous struct {
+	nodes []string
+}
+
+func NewRendezvous() *Rendezvous {
+	return &Rendezvous{}
+}
+
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		if !slices.Contains(r.nodes, node) {
+			r.nodes = append(r.nodes, node)
+		}
+	}
+}
+
+func (r *Rendezvous) Remove(nodes ...string) {
+	r.nodes = removeNodes(r.nodes, nodes)
+}
+
+func (r *Rendezvous) Get(key string) string {
+	var best string
+	var bestScore uint64
+	for _, node := range r.nodes {
+		score := hash64(node, key)
+		// 分数相同时按节点名决定，保证结果和添加顺序无关
+		if best == "" || score > bestScore || (score == bestScore && node < best) {
+			best, bestScore = node, score
+		}
+	}
+	return best
+}
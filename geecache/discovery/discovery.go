@@ -0,0 +1,183 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Discovery 返回当前集群中所有节点的地址，包括自己
+type Discovery interface {
+	Peers(ctx context.Context) ([]string, error)
+}
+
+// Membership 由 geecache.HTTPPool 和 geecache.GRPCPool 实现，用来增量地修改哈希环
+type Membership interface {
+	AddPeer(peers ...string)
+	RemovePeer(peers ...string)
+}
+
+// Watch 立即同步一次节点列表，之后每隔interval再同步一次，直到ctx被取消
+// 每次只把新增和消失的节点通知给m，已有节点的连接不受影响
+func Watch(ctx context.Context, d Discovery, interval time.Duration, m Membership) {
+	known := make(map[string]bool)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := syncPeers(ctx, d, m, known); err != nil {
+			log.Println("[Discovery] sync peers failed:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 和上一次的结果做对比，known在调用后更新为这一次的节点列表
+func syncPeers(ctx context.Context, d Discovery, m Membership, known map[string]bool) error {
+	peers, err := d.Peers(ctx)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]bool, len(peers))
+	addrs := make(map[string]bool, len(peers))
+	var added, removed []string
+	for _, peer := range peers {
+		current[peer] = true
+		addrs[specAddr(peer)] = true
+		if !known[peer] {
+			added = append(added, peer)
+		}
+	}
+	for peer := range known {
+		// 地址还在、只是权重变了的节点，AddPeer已经更新了权重，不能再删除
+		if !current[peer] && !addrs[specAddr(peer)] {
+			removed = append(removed, peer)
+		}
+	}
+	if len(added) > 0 {
+		m.AddPeer(added...)
+	}
+	if len(removed) > 0 {
+		m.RemovePeer(removed...)
+	}
+	clear(known)
+	for peer := range current {
+		known[peer] = true
+	}
+	return nil
+}
+
+// 节点描述 "地址 权重" 中的地址
+func specAddr(spec string) string {
+	addr, _, _ := strings.Cut(strings.TrimSpace(spec), " ")
+	return addr
+}
+
+// Static 是固定的节点列表
+type Static []string
+
+func (s Static) Peers(ctx context.Context) ([]string, error) {
+	return s, nil
+}
+
+// ---------------------StaticFile 从本地文件读取节点列表--------------------
+
+// StaticFile 每行一个节点，格式是 "地址" 或者 "地址 权重"（见 geecache.ParsePeerSpec），
+// 空行和#开头的行会被忽略，修改文件后下一次同步生效
+type StaticFile struct {
+	Path string
+}
+
+func (f StaticFile) Peers(ctx context.Context) ([]string, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var peers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// 统一空白字符，只改了空格的行不会被当成新节点
+		peers = append(peers, strings.Join(strings.Fields(line), " "))
+	}
+	return peers, scanner.Err()
+}
+
+// ---------------------DNSSRV 从DNS SRV记录读取节点列表--------------------
+
+// DNSSRV 查询 _service._proto.name 的SRV记录，每条记录对应一个节点
+type DNSSRV struct {
+	Service  string
+	Proto    string
+	Name     string
+	Scheme   string        // 拼在地址前面的协议，比如 "http://"，gRPC节点留空
+	Resolver *net.Resolver // 为nil时使用net.DefaultResolver
+}
+
+func (d DNSSRV) Peers(ctx context.Context) ([]string, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	_, records, err := resolver.LookupSRV(ctx, d.Service, d.Proto, d.Name)
+	if err != nil {
+		return nil, fmt.Errorf("lookup srv %s: %w", d.Name, err)
+	}
+	peers := make([]string, 0, len(records))
+	for _, r := range records {
+		host := strings.TrimSuffix(r.Target, ".")
+		peers = append(peers, d.Scheme+net.JoinHostPort(host, strconv.Itoa(int(r.Port))))
+	}
+	return peers, nil
+}
+
+// ---------------------Registry 进程内的注册中心--------------------
+
+// Registry 是一个简单的内存注册中心，节点启动时Register，退出时Deregister，
+// 可以在测试或者单机部署时代替etcd、consul之类的注册中心
+type Registry struct {
+	mu    sync.Mutex
+	peers map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{peers: make(map[string]bool)}
+}
+
+func (r *Registry) Register(peer string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.peers[peer] = true
+}
+
+func (r *Registry) Deregister(peer string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.peers, peer)
+}
+
+func (r *Registry) Peers(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	peers := make([]string, 0, len(r.peers))
+	for peer := range r.peers {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers, nil
+}
@@ -0,0 +1,118 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"mikucache/geecache"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	_ Membership = (*geecache.HTTPPool)(nil)
+	_ Membership = (*geecache.GRPCPool)(nil)
+)
+
+type fakeMembership struct {
+	mu    sync.Mutex
+	peers map[string]bool
+}
+
+func (m *fakeMembership) AddPeer(peers ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range peers {
+		m.peers[p] = true
+	}
+}
+
+func (m *fakeMembership) RemovePeer(peers ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range peers {
+		delete(m.peers, p)
+	}
+}
+
+func (m *fakeMembership) list() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var peers []string
+	for p := range m.peers {
+		peers = append(peers, p)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+func TestWatchRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Register("http://localhost:8001")
+	r.Register("http://localhost:8002")
+	m := &fakeMembership{peers: make(map[string]bool)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, r, 5*time.Millisecond, m)
+
+	waitFor(t, m, []string{"http://localhost:8001", "http://localhost:8002"})
+	r.Deregister("http://localhost:8001")
+	r.Register("http://localhost:8003")
+	waitFor(t, m, []string{"http://localhost:8002", "http://localhost:8003"})
+}
+
+func waitFor(t *testing.T, m *fakeMembership, want []string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if reflect.DeepEqual(m.list(), want) {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("peers = %v, want %v", m.list(), want)
+}
+
+func TestStaticFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers")
+	content := "# cache nodes\nhttp://localhost:8001\n\n  http://localhost:8002  \nhttp://localhost:8003 \t 2\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	peers, err := StaticFile{Path: path}.Peers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003 2"}
+	if !reflect.DeepEqual(peers, want) {
+		t.Fatalf("peers = %v, want %v", peers, want)
+	}
+}
+
+// 节点列表中只修改了权重时，节点不能被删掉
+func TestSyncPeersWeightChange(t *testing.T) {
+	pool := geecache.NewHTTPPool("http://node1")
+	known := make(map[string]bool)
+	for _, peers := range []Static{
+		{"http://node1", "http://node2"},
+		{"http://node1", "http://node2 3"},
+	} {
+		if err := syncPeers(context.Background(), peers, pool, known); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := pool.PickPeer("Tom"); !ok {
+		for i := 0; ; i++ {
+			if i == 100 {
+				t.Fatal("node2 was removed after its weight changed")
+			}
+			if _, ok = pool.PickPeer(fmt.Sprintf("key%d", i)); ok {
+				break
+			}
+		}
+	}
+}
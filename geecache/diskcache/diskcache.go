@@ -0,0 +1,502 @@
+// Package diskcache 是放在本地磁盘上的缓存，用作内存缓存之后的第二级缓存。
+//
+// 数据以追加写的方式保存在一组日志文件(segment)中，内存中只保存key到文件位置的索引。
+// 覆盖和删除都是追加一条新记录，旧记录变成垃圾，由后台的压缩(compaction)回收；
+// 总大小超过上限时整个删除最旧的segment，相当于按写入顺序的FIFO淘汰
+package diskcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 每个segment的默认大小上限，写满之后新建一个
+	defaultSegmentBytes = 64 << 20
+	// 垃圾超过segment大小的这个比例时压缩它
+	compactRatio = 0.5
+
+	segmentSuffix = ".log"
+	// 记录头：crc32(4) | flags(1) | 过期时间unix纳秒(8) | key长度(4) | value长度(4)，
+	// crc32覆盖crc之后的所有字节
+	headerSize    = 21
+	flagTombstone = 1 // 删除标记，没有value
+)
+
+var errCorrupt = errors.New("diskcache: corrupt record")
+
+// ErrClosed 表示Store已经关闭。Group在后台写L2，关闭之后可能还有写入
+var ErrClosed = errors.New("diskcache: store closed")
+
+// Store 是磁盘缓存，并发安全
+type Store struct {
+	mu           sync.Mutex
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+	segments     []*segment // 按id从旧到新排列，最后一个是正在写入的
+	index        map[string]location
+	size         int64 // 所有segment文件的总大小
+	nextID       int
+	// 压缩在后台进行，Put只是通知compactLoop，不会等一个segment复制完
+	compactMu sync.Mutex // 同一时间只有一次压缩
+	compactC  chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type segment struct {
+	id   int
+	f    *os.File
+	size int64
+	live int64 // 被索引引用的字节数，size-live就是垃圾
+}
+
+// 记录在磁盘上的位置
+type location struct {
+	seg    *segment
+	offset int64
+	size   int64 // 整条记录的大小，包括记录头
+	expire time.Time
+}
+
+// Option 用来配置Store
+type Option func(*Store)
+
+// WithSegmentBytes 设置每个segment文件的大小上限，默认64MB
+func WithSegmentBytes(n int64) Option {
+	return func(s *Store) {
+		s.segmentBytes = n
+	}
+}
+
+// Open 打开dir下的磁盘缓存，目录不存在时创建，已有的数据会重新建立索引。
+// maxBytes是所有文件总大小的上限，0表示不限制
+func Open(dir string, maxBytes int64, opts ...Option) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: defaultSegmentBytes,
+		index:        make(map[string]location),
+		compactC:     make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	ids, err := s.segmentIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		seg, err := s.openSegment(id)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.segments = append(s.segments, seg)
+		s.size += seg.size
+		if err = s.load(seg); err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.nextID = id + 1
+	}
+	if len(s.segments) == 0 {
+		if err = s.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	s.wg.Add(1)
+	go s.compactLoop()
+	return s, nil
+}
+
+// 目录中已有的segment编号，从小到大
+func (s *Store) segmentIDs() ([]int, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, name := range names {
+		id, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(name), segmentSuffix))
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (s *Store) segmentPath(id int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%08d%s", id, segmentSuffix))
+}
+
+func (s *Store) openSegment(id int) (*segment, error) {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &segment{id: id, f: f, size: info.Size()}, nil
+}
+
+// 顺序读取segment中的所有记录，重建索引。进程崩溃时最后一条记录可能只写了一半，从那里截断
+func (s *Store) load(seg *segment) error {
+	now := time.Now()
+	var offset int64
+	for offset < seg.size {
+		rec, err := readRecord(seg.f, offset, seg.size)
+		if err != nil {
+			if errors.Is(err, errCorrupt) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+				s.size -= seg.size - offset
+				seg.size = offset
+				return seg.f.Truncate(offset)
+			}
+			return err
+		}
+		s.forget(rec.key)
+		if !rec.tombstone && !expired(rec.expire, now) {
+			s.index[rec.key] = location{seg: seg, offset: offset, size: rec.size, expire: rec.expire}
+			seg.live += rec.size
+		}
+		offset += rec.size
+	}
+	return nil
+}
+
+// 新建一个segment用来写入
+func (s *Store) rotate() error {
+	seg, err := s.openSegment(s.nextID)
+	if err != nil {
+		return err
+	}
+	s.nextID++
+	s.segments = append(s.segments, seg)
+	s.size += seg.size
+	return nil
+}
+
+func (s *Store) active() *segment {
+	return s.segments[len(s.segments)-1]
+}
+
+// Put 写入key的值，expire为零值表示永不过期
+func (s *Store) Put(key string, value []byte, expire time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.segments == nil {
+		return ErrClosed
+	}
+	if err := s.put(key, value, expire, false); err != nil {
+		return err
+	}
+	if s.needsCompaction() {
+		select {
+		case s.compactC <- struct{}{}:
+		default:
+		}
+	}
+	return s.evict()
+}
+
+// Get 返回key的值和过期时间，key不存在或已经过期时ok为false
+func (s *Store) Get(key string) (value []byte, expire time.Time, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loc, ok := s.index[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	if expired(loc.expire, time.Now()) {
+		s.forget(key)
+		return nil, time.Time{}, false
+	}
+	rec, err := readRecord(loc.seg.f, loc.offset, loc.seg.size)
+	if err != nil || rec.key != key {
+		// 读不出来就当作不存在，这只是缓存
+		s.forget(key)
+		return nil, time.Time{}, false
+	}
+	return rec.value, rec.expire, true
+}
+
+// Delete 删除key，写入删除标记，重启之后也不会再读到旧值
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.segments == nil {
+		return ErrClosed
+	}
+	if _, ok := s.index[key]; !ok {
+		return nil
+	}
+	s.forget(key)
+	return s.put(key, nil, time.Time{}, true)
+}
+
+// Len 返回key的数量
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.index)
+}
+
+// Size 返回所有segment文件的总大小
+func (s *Store) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Close 停止后台压缩并关闭所有文件，之后Put和Delete返回ErrClosed，Get总是未命中
+func (s *Store) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, seg := range s.segments {
+		errs = append(errs, seg.f.Close())
+	}
+	s.segments = nil
+	return errors.Join(errs...)
+}
+
+// 追加一条记录到正在写入的segment，写满时先新建一个
+func (s *Store) put(key string, value []byte, expire time.Time, tombstone bool) error {
+	buf := encodeRecord(key, value, expire, tombstone)
+	if seg := s.active(); seg.size > 0 && seg.size+int64(len(buf)) > s.segmentBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	seg := s.active()
+	if _, err := seg.f.WriteAt(buf, seg.size); err != nil {
+		return err
+	}
+	loc := location{seg: seg, offset: seg.size, size: int64(len(buf)), expire: expire}
+	seg.size += loc.size
+	s.size += loc.size
+	if !tombstone {
+		s.forget(key)
+		s.index[key] = loc
+		seg.live += loc.size
+	}
+	return nil
+}
+
+// 从索引中删除key，它的记录变成垃圾
+func (s *Store) forget(key string) {
+	if loc, ok := s.index[key]; ok {
+		loc.seg.live -= loc.size
+		delete(s.index, key)
+	}
+}
+
+// 总大小超过上限时从最旧的segment开始整个删除
+func (s *Store) evict() error {
+	for s.maxBytes > 0 && s.size > s.maxBytes {
+		if len(s.segments) == 1 {
+			// 只剩正在写入的segment，换一个新的再删掉它
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+		if err := s.drop(s.segments[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 垃圾超过compactRatio的segment，正在写入的除外
+func (s *Store) garbageSegments() []*segment {
+	var segs []*segment
+	for _, seg := range s.segments[:max(len(s.segments)-1, 0)] {
+		if float64(seg.size-seg.live) > compactRatio*float64(seg.size) {
+			segs = append(segs, seg)
+		}
+	}
+	return segs
+}
+
+func (s *Store) needsCompaction() bool {
+	return len(s.garbageSegments()) > 0
+}
+
+func (s *Store) compactLoop() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.compactC:
+			// 失败时只是留着垃圾，下次Put之后再试
+			s.compactAll()
+		}
+	}
+}
+
+// 压缩所有垃圾太多的segment
+func (s *Store) compactAll() error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+	s.mu.Lock()
+	segs := s.garbageSegments()
+	s.mu.Unlock()
+	for _, seg := range segs {
+		if err := s.compact(seg); err != nil {
+			return err
+		}
+	}
+	// 复制过来的记录可能让总大小超过上限
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.evict()
+}
+
+// 把seg中还被索引引用的记录复制到正在写入的segment，然后删除seg。
+// 删除标记只有在比seg更旧的segment中可能还有这个key的旧值时才需要保留。
+// 不再写入的segment内容不会变，读取时不用持有锁，每复制一条记录加一次锁，
+// 不会让Get和Put等待整个segment复制完。seg可能在中途因为超过总大小上限被删除，这时直接放弃
+func (s *Store) compact(seg *segment) error {
+	var offset int64
+	for offset < seg.size {
+		select {
+		case <-s.done:
+			return nil
+		default:
+		}
+		rec, err := readRecord(seg.f, offset, seg.size)
+		s.mu.Lock()
+		if !slices.Contains(s.segments, seg) {
+			s.mu.Unlock()
+			return nil
+		}
+		if err == nil {
+			err = s.copyRecord(seg, offset, rec)
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		offset += rec.size
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.Contains(s.segments, seg) {
+		return nil
+	}
+	return s.drop(seg)
+}
+
+// 复制compact读到的一条记录，调用方持有s.mu
+func (s *Store) copyRecord(seg *segment, offset int64, rec record) error {
+	loc, ok := s.index[rec.key]
+	switch {
+	case ok && loc.seg == seg && loc.offset == offset:
+		return s.put(rec.key, rec.value, rec.expire, false)
+	case rec.tombstone && seg != s.segments[0] && !ok:
+		return s.put(rec.key, nil, time.Time{}, true)
+	}
+	return nil
+}
+
+// 删除整个segment，其中的key从索引中删除
+func (s *Store) drop(seg *segment) error {
+	for key, loc := range s.index {
+		if loc.seg == seg {
+			s.forget(key)
+		}
+	}
+	s.segments = slices.DeleteFunc(s.segments, func(other *segment) bool { return other == seg })
+	s.size -= seg.size
+	seg.f.Close()
+	return os.Remove(seg.f.Name())
+}
+
+type record struct {
+	key       string
+	value     []byte
+	expire    time.Time
+	tombstone bool
+	size      int64
+}
+
+func encodeRecord(key string, value []byte, expire time.Time, tombstone bool) []byte {
+	buf := make([]byte, headerSize, headerSize+len(key)+len(value))
+	if tombstone {
+		buf[4] = flagTombstone
+	}
+	var nanos int64
+	if !expire.IsZero() {
+		nanos = expire.UnixNano()
+	}
+	binary.BigEndian.PutUint64(buf[5:], uint64(nanos))
+	binary.BigEndian.PutUint32(buf[13:], uint32(len(key)))
+	binary.BigEndian.PutUint32(buf[17:], uint32(len(value)))
+	buf = append(buf, key...)
+	buf = append(buf, value...)
+	binary.BigEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+// 读取offset处的记录，size是文件中有效数据的大小，记录不能超出它
+func readRecord(f *os.File, offset, size int64) (record, error) {
+	header := make([]byte, headerSize)
+	if _, err := f.ReadAt(header, offset); err != nil {
+		return record{}, err
+	}
+	keyLen := int64(binary.BigEndian.Uint32(header[13:]))
+	valueLen := int64(binary.BigEndian.Uint32(header[17:]))
+	// 损坏的记录头可能声明几GB的长度，分配内存之前先检查
+	if keyLen+valueLen > size-offset-headerSize {
+		return record{}, errCorrupt
+	}
+	body := make([]byte, keyLen+valueLen)
+	if _, err := f.ReadAt(body, offset+headerSize); err != nil {
+		return record{}, err
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(body)
+	if crc.Sum32() != binary.BigEndian.Uint32(header) {
+		return record{}, errCorrupt
+	}
+	rec := record{
+		key:       string(body[:keyLen]),
+		value:     body[keyLen:],
+		tombstone: header[4]&flagTombstone != 0,
+		size:      headerSize + keyLen + valueLen,
+	}
+	if nanos := int64(binary.BigEndian.Uint64(header[5:])); nanos != 0 {
+		rec.expire = time.Unix(0, nanos)
+	}
+	return rec, nil
+}
+
+func expired(expire, now time.Time) bool {
+	return !expire.IsZero() && !now.Before(expire)
+}
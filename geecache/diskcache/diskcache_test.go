@@ -0,0 +1,225 @@
+package diskcache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func open(t *testing.T, dir string, maxBytes int64, opts ...Option) *Store {
+	t.Helper()
+	s, err := Open(dir, maxBytes, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func mustGet(t *testing.T, s *Store, key, want string) {
+	t.Helper()
+	if v, _, ok := s.Get(key); !ok || string(v) != want {
+		t.Fatalf("Get(%s) = %q, %v, want %q", key, v, ok, want)
+	}
+}
+
+func mustMiss(t *testing.T, s *Store, key string) {
+	t.Helper()
+	if v, _, ok := s.Get(key); ok {
+		t.Fatalf("Get(%s) = %q, want miss", key, v)
+	}
+}
+
+func TestPutGet(t *testing.T) {
+	s := open(t, t.TempDir(), 0)
+	s.Put("Tom", []byte("630"), time.Time{})
+	s.Put("Jack", []byte("589"), time.Time{})
+	s.Put("Tom", []byte("631"), time.Time{})
+	mustGet(t, s, "Tom", "631")
+	mustGet(t, s, "Jack", "589")
+	mustMiss(t, s, "Sam")
+	if s.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", s.Len())
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	expire := time.Now().Add(time.Hour)
+	s := open(t, dir, 0, WithSegmentBytes(64))
+	for i := 0; i < 10; i++ {
+		s.Put(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)), expire)
+	}
+	s.Delete("key3")
+	s.Close()
+
+	s = open(t, dir, 0, WithSegmentBytes(64))
+	for i := 0; i < 10; i++ {
+		if i == 3 {
+			// 删除标记也被保存了
+			mustMiss(t, s, "key3")
+			continue
+		}
+		mustGet(t, s, fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	if _, e, _ := s.Get("key0"); !e.Equal(expire) {
+		t.Fatalf("expire = %v, want %v", e, expire)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	s := open(t, t.TempDir(), 0)
+	s.Put("short", []byte("v"), time.Now().Add(20*time.Millisecond))
+	s.Put("long", []byte("v"), time.Now().Add(time.Hour))
+	time.Sleep(30 * time.Millisecond)
+	mustMiss(t, s, "short")
+	mustGet(t, s, "long", "v")
+}
+
+func TestMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	value := make([]byte, 100)
+	// 每条记录大约125字节，每个segment放4条，最多保留4个segment
+	s := open(t, dir, 2000, WithSegmentBytes(500))
+	for i := 0; i < 100; i++ {
+		if err := s.Put(fmt.Sprintf("key%04d", i), value, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if s.Size() > 2000 {
+			t.Fatalf("Size() = %d after %d puts, want <= 2000", s.Size(), i+1)
+		}
+	}
+	// 最早写入的被淘汰，最近写入的还在
+	mustMiss(t, s, "key0000")
+	mustGet(t, s, "key0099", string(value))
+	names, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	if len(names) > 5 {
+		t.Fatalf("%d segment files left, want <= 5", len(names))
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, 0, WithSegmentBytes(500))
+	value := make([]byte, 100)
+	// 反复覆盖同一批key，旧的segment基本都是垃圾
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 4; i++ {
+			s.Put(fmt.Sprintf("key%d", i), value, time.Time{})
+		}
+	}
+	s.Put("last", []byte("v"), time.Time{})
+	// 压缩在后台进行，这里等它做完
+	if err := s.compactAll(); err != nil {
+		t.Fatal(err)
+	}
+	// 4个key加上可能还没写满的segment，远小于80次写入的总量
+	if s.Size() > 1500 {
+		t.Fatalf("Size() = %d, garbage was not compacted", s.Size())
+	}
+	for i := 0; i < 4; i++ {
+		mustGet(t, s, fmt.Sprintf("key%d", i), string(value))
+	}
+	s.Close()
+
+	s = open(t, dir, 0, WithSegmentBytes(500))
+	for i := 0; i < 4; i++ {
+		mustGet(t, s, fmt.Sprintf("key%d", i), string(value))
+	}
+	mustGet(t, s, "last", "v")
+}
+
+func TestDeleteSurvivesCompaction(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, 0, WithSegmentBytes(200))
+	value := make([]byte, 100)
+	s.Put("deleted", value, time.Time{})
+	s.Put("other", value, time.Time{})
+	s.Delete("deleted")
+	for i := 0; i < 20; i++ {
+		s.Put("other", value, time.Time{})
+	}
+	if err := s.compactAll(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = open(t, dir, 0, WithSegmentBytes(200))
+	mustMiss(t, s, "deleted")
+	mustGet(t, s, "other", string(value))
+}
+
+func TestTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, 0)
+	s.Put("Tom", []byte("630"), time.Time{})
+	s.Put("Jack", []byte("589"), time.Time{})
+	s.Close()
+
+	// 模拟写到一半崩溃：最后一条记录被截断
+	name := filepath.Join(dir, "00000000.log")
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Truncate(name, info.Size()-2); err != nil {
+		t.Fatal(err)
+	}
+	s = open(t, dir, 0)
+	mustGet(t, s, "Tom", "630")
+	mustMiss(t, s, "Jack")
+	// 截断之后可以继续写入
+	s.Put("Jack", []byte("590"), time.Time{})
+	s.Close()
+	s = open(t, dir, 0)
+	mustGet(t, s, "Jack", "590")
+}
+
+func TestCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, 0)
+	s.Put("Tom", []byte("630"), time.Time{})
+	s.Close()
+
+	name := filepath.Join(dir, "00000000.log")
+	data, _ := os.ReadFile(name)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(name, data, 0o644)
+	s = open(t, dir, 0)
+	mustMiss(t, s, "Tom")
+}
+
+func TestHugeRecordLength(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, dir, 0)
+	s.Put("Tom", []byte("630"), time.Time{})
+	s.Put("Jack", []byte("589"), time.Time{})
+	s.Close()
+
+	// 把第二条记录头中的长度改成最大值，读取时不能按它分配内存
+	name := filepath.Join(dir, "00000000.log")
+	data, _ := os.ReadFile(name)
+	second := headerSize + len("Tom") + len("630")
+	binary.BigEndian.PutUint32(data[second+13:], ^uint32(0))
+	binary.BigEndian.PutUint32(data[second+17:], ^uint32(0))
+	os.WriteFile(name, data, 0o644)
+	s = open(t, dir, 0)
+	mustGet(t, s, "Tom", "630")
+	mustMiss(t, s, "Jack")
+}
+
+func TestClosed(t *testing.T) {
+	s := open(t, t.TempDir(), 0)
+	s.Put("Tom", []byte("630"), time.Time{})
+	s.Close()
+	if err := s.Put("Jack", []byte("589"), time.Time{}); err != ErrClosed {
+		t.Fatalf("Put after Close = %v, want ErrClosed", err)
+	}
+	if err := s.Delete("Tom"); err != ErrClosed {
+		t.Fatalf("Delete after Close = %v, want ErrClosed", err)
+	}
+	mustMiss(t, s, "Tom")
+}
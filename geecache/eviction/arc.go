@@ -0,0 +1,112 @@
+package eviction
+
+import (
+	"container/list"
+	"mikucache/geecache/lru"
+	"time"
+)
+
+// arc 是按字节计算的Adaptive Replacement Cache：
+// t1保存只访问过一次的记录，t2保存访问过多次的记录，b1、b2是从t1、t2淘汰的幽灵记录，只保留key。
+// 命中b1说明t1太小，命中b2说明t2太小，p据此在两者之间自动调整
+type arc struct {
+	base
+	t1, t2 *queue
+	b1, b2 *queue
+	ghosts map[string]*list.Element
+	p      int64 // t1的目标字节数
+}
+
+// NewARC 创建一个ARC策略，在近期访问和频繁访问之间自适应，扫描只会冲掉t1
+func NewARC(maxBytes int64, onEvicted func(string, Value, EvictReason)) Policy {
+	return &arc{
+		base:   newBase(maxBytes, onEvicted),
+		t1:     newQueue(),
+		t2:     newQueue(),
+		b1:     newQueue(),
+		b2:     newQueue(),
+		ghosts: make(map[string]*list.Element),
+	}
+}
+
+func (c *arc) AddWithExpire(key string, value Value, expire time.Time) {
+	if ele, ok := c.lookup(key); ok {
+		c.update(ele, value, expire)
+		c.move(ele, c.t2)
+		c.reclaim(0, false)
+		return
+	}
+	e := newEntry(key, value, expire)
+	ghost, ok := c.ghosts[key]
+	if !ok {
+		c.reclaim(e.bytes, false)
+		c.insert(c.t1, e)
+		c.trimGhosts()
+		return
+	}
+	// 命中幽灵记录，按两个幽灵队列的大小比例调整p
+	inB2 := ghost.Value.(*entry).queue == c.b2
+	if !inB2 {
+		c.p = min(c.p+scaled(e.bytes, c.b2.bytes, c.b1.bytes), c.maxBytes)
+	} else {
+		c.p = max(c.p-scaled(e.bytes, c.b1.bytes, c.b2.bytes), 0)
+	}
+	c.removeGhost(ghost)
+	c.reclaim(e.bytes, inB2)
+	c.insert(c.t2, e)
+	c.trimGhosts()
+}
+
+// Range 先遍历只访问过一次的t1，再遍历t2，幽灵记录不包括在内
+func (c *arc) Range(fn func(key string, value Value, expire time.Time) bool) {
+	rangeQueues(fn, c.t1, c.t2)
+}
+
+func (c *arc) Get(key string) (Value, bool) {
+	ele, ok := c.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	c.move(ele, c.t2)
+	return ele.Value.(*entry).value, true
+}
+
+// 返回 size*max(1, num/den)
+func scaled(size, num, den int64) int64 {
+	if den == 0 || num <= den {
+		return size
+	}
+	return size * num / den
+}
+
+// 腾出extra字节的空间，t1超过目标大小时从t1淘汰，否则从t2淘汰
+func (c *arc) reclaim(extra int64, inB2 bool) {
+	for c.maxBytes != 0 && c.nbytes+extra > c.maxBytes && c.Len() > 0 {
+		from, ghost := c.t2, c.b2
+		if c.t1.len() > 0 && (c.t1.bytes > c.p || (inB2 && c.t1.bytes == c.p) || c.t2.len() == 0) {
+			from, ghost = c.t1, c.b1
+		}
+		e := c.evict(from.ll.Back(), lru.EvictCapacity)
+		e.value = nil
+		c.ghosts[e.key] = ghost.pushFront(e)
+	}
+}
+
+// t1+b1不超过maxBytes，四个队列加起来不超过2*maxBytes
+func (c *arc) trimGhosts() {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.t1.bytes+c.b1.bytes > c.maxBytes && c.b1.len() > 0 {
+		c.removeGhost(c.b1.ll.Back())
+	}
+	for c.nbytes+c.b1.bytes+c.b2.bytes > 2*c.maxBytes && c.b2.len() > 0 {
+		c.removeGhost(c.b2.ll.Back())
+	}
+}
+
+func (c *arc) removeGhost(ele *list.Element) {
+	e := ele.Value.(*entry)
+	e.queue.remove(ele)
+	delete(c.ghosts, e.key)
+}
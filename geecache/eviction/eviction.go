@@ -0,0 +1,209 @@
+package eviction
+
+import (
+	"container/list"
+	"mikucache/geecache/lru"
+	"time"
+)
+
+type Value = lru.Value
+type EvictReason = lru.EvictReason
+
+// Policy 是缓存的淘汰策略，和lru.Cache一样不是并发安全的，由调用方加锁
+type Policy interface {
+	// 添加一条记录，到了expire之后就不能再被Get到了，expire为零值表示永不过期
+	AddWithExpire(key string, value Value, expire time.Time)
+	Get(key string) (Value, bool)
+	// 删除key对应的记录，返回记录是否存在
+	Remove(key string) bool
+	// 清除所有已经过期的记录，返回清除的数量
+	RemoveExpired() int
+	Bytes() int64
+	Len() int
+}
+
+// Ranger 由可以遍历所有记录的Policy实现，Group.Snapshot用它保存缓存。
+// Range按淘汰的先后顺序遍历没有过期的记录，最先会被淘汰的在前，fn返回false时停止；
+// 按同样的顺序重新添加可以大致恢复原来的状态（访问频率之类的统计不会保留）
+type Ranger interface {
+	Range(fn func(key string, value Value, expire time.Time) bool)
+}
+
+// Factory 创建一个内存上限为maxBytes的Policy，maxBytes为0表示不限制，
+// 记录被清除时调用onEvicted
+type Factory func(maxBytes int64, onEvicted func(string, Value, EvictReason)) Policy
+
+var (
+	_ Factory = NewLRU
+	_ Factory = NewLFU
+	_ Factory = NewARC
+	_ Factory = NewTwoQueue
+	_ Factory = NewTinyLFU
+
+	_ Ranger = (*lru.Cache)(nil)
+	_ Ranger = (*lfu)(nil)
+	_ Ranger = (*arc)(nil)
+	_ Ranger = (*twoQueue)(nil)
+	_ Ranger = (*tinyLFU)(nil)
+)
+
+// NewLRU 就是lru.Cache，淘汰最久没有访问的记录
+func NewLRU(maxBytes int64, onEvicted func(string, Value, EvictReason)) Policy {
+	return lru.New(maxBytes, onEvicted)
+}
+
+// 各个策略共用的记录
+type entry struct {
+	key    string
+	value  Value // 幽灵记录只保留key，value为nil
+	expire time.Time
+	bytes  int64  // len(key)+value.Len()，幽灵记录保留原来的大小
+	queue  *queue // 记录当前所在的队列
+	freq   int    // 只有LFU使用
+}
+
+func newEntry(key string, value Value, expire time.Time) *entry {
+	return &entry{key: key, value: value, expire: expire, bytes: int64(len(key)) + int64(value.Len())}
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+// queue 是一个记录了总字节数的双向链表，头部是最近加入或访问的记录
+type queue struct {
+	ll    *list.List
+	bytes int64
+}
+
+func newQueue() *queue {
+	return &queue{ll: list.New()}
+}
+
+func (q *queue) pushFront(e *entry) *list.Element {
+	e.queue = q
+	q.bytes += e.bytes
+	return q.ll.PushFront(e)
+}
+
+func (q *queue) remove(ele *list.Element) *entry {
+	e := q.ll.Remove(ele).(*entry)
+	q.bytes -= e.bytes
+	e.queue = nil
+	return e
+}
+
+func (q *queue) len() int {
+	return q.ll.Len()
+}
+
+// 依次从尾部到头部遍历queues中没有过期的记录，fn返回false时返回false
+func rangeQueues(fn func(key string, value Value, expire time.Time) bool, queues ...*queue) bool {
+	now := time.Now()
+	for _, q := range queues {
+		for ele := q.ll.Back(); ele != nil; ele = ele.Prev() {
+			e := ele.Value.(*entry)
+			if e.expired(now) {
+				continue
+			}
+			if !fn(e.key, e.value, e.expire) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// base 保存所有策略共用的索引和字节统计，只包括常驻的记录，幽灵记录由各个策略自己管理
+type base struct {
+	maxBytes  int64
+	nbytes    int64
+	items     map[string]*list.Element
+	onEvicted func(string, Value, EvictReason)
+}
+
+func newBase(maxBytes int64, onEvicted func(string, Value, EvictReason)) base {
+	return base{maxBytes: maxBytes, items: make(map[string]*list.Element), onEvicted: onEvicted}
+}
+
+// 超过了最大内存
+func (b *base) overflow() bool {
+	return b.maxBytes != 0 && b.nbytes > b.maxBytes
+}
+
+// 查找key，读到过期的记录直接删除
+func (b *base) lookup(key string) (*list.Element, bool) {
+	ele, ok := b.items[key]
+	if !ok {
+		return nil, false
+	}
+	if ele.Value.(*entry).expired(time.Now()) {
+		b.evict(ele, lru.EvictExpired)
+		return nil, false
+	}
+	return ele, true
+}
+
+func (b *base) insert(q *queue, e *entry) {
+	b.items[e.key] = q.pushFront(e)
+	b.nbytes += e.bytes
+}
+
+// 把记录移动到另一个队列的头部
+func (b *base) move(ele *list.Element, to *queue) *list.Element {
+	e := ele.Value.(*entry)
+	e.queue.remove(ele)
+	ele = to.pushFront(e)
+	b.items[e.key] = ele
+	return ele
+}
+
+// 更新已有记录的值
+func (b *base) update(ele *list.Element, value Value, expire time.Time) {
+	e := ele.Value.(*entry)
+	delta := int64(value.Len()) - int64(e.value.Len())
+	e.queue.bytes += delta
+	e.bytes += delta
+	b.nbytes += delta
+	e.value = value
+	e.expire = expire
+}
+
+func (b *base) evict(ele *list.Element, reason EvictReason) *entry {
+	e := ele.Value.(*entry)
+	e.queue.remove(ele)
+	delete(b.items, e.key)
+	b.nbytes -= e.bytes
+	if b.onEvicted != nil {
+		b.onEvicted(e.key, e.value, reason)
+	}
+	return e
+}
+
+func (b *base) Remove(key string) bool {
+	if ele, ok := b.items[key]; ok {
+		b.evict(ele, lru.EvictRemoved)
+		return true
+	}
+	return false
+}
+
+func (b *base) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, ele := range b.items {
+		if ele.Value.(*entry).expired(now) {
+			b.evict(ele, lru.EvictExpired)
+			n++
+		}
+	}
+	return n
+}
+
+func (b *base) Bytes() int64 {
+	return b.nbytes
+}
+
+func (b *base) Len() int {
+	return len(b.items)
+}
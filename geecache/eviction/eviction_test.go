@@ -0,0 +1,213 @@
+package eviction
+
+import (
+	"fmt"
+	"mikucache/geecache/lru"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (s String) Len() int {
+	return len(s)
+}
+
+var policies = map[string]Factory{
+	"LRU":     NewLRU,
+	"LFU":     NewLFU,
+	"ARC":     NewARC,
+	"2Q":      NewTwoQueue,
+	"TinyLFU": NewTinyLFU,
+}
+
+func TestPolicyBasics(t *testing.T) {
+	for name, newPolicy := range policies {
+		t.Run(name, func(t *testing.T) {
+			evicted := make(map[string]EvictReason)
+			p := newPolicy(0, func(key string, value Value, reason EvictReason) {
+				evicted[key] = reason
+			})
+			p.AddWithExpire("key1", String("1234"), time.Time{})
+			p.AddWithExpire("key2", String("5678"), time.Now().Add(-time.Second))
+			if v, ok := p.Get("key1"); !ok || v.(String) != "1234" {
+				t.Fatalf("get key1 = %v, %v", v, ok)
+			}
+			if _, ok := p.Get("key2"); ok {
+				t.Fatal("expired key2 should not be returned")
+			}
+			p.AddWithExpire("key1", String("12"), time.Time{})
+			if p.Len() != 1 || p.Bytes() != int64(len("key1")+len("12")) {
+				t.Fatalf("len = %d, bytes = %d after update", p.Len(), p.Bytes())
+			}
+			if !p.Remove("key1") || p.Remove("key1") {
+				t.Fatal("remove key1 should succeed exactly once")
+			}
+			if p.Len() != 0 || p.Bytes() != 0 {
+				t.Fatalf("len = %d, bytes = %d after remove", p.Len(), p.Bytes())
+			}
+			if evicted["key1"] != lru.EvictRemoved || evicted["key2"] != lru.EvictExpired {
+				t.Fatalf("unexpected evict reasons %v", evicted)
+			}
+		})
+	}
+}
+
+func TestPolicyRemoveExpired(t *testing.T) {
+	for name, newPolicy := range policies {
+		t.Run(name, func(t *testing.T) {
+			p := newPolicy(0, nil)
+			p.AddWithExpire("k1", String("v"), time.Now().Add(-time.Second))
+			p.AddWithExpire("k2", String("v"), time.Now().Add(time.Hour))
+			p.AddWithExpire("k3", String("v"), time.Time{})
+			if n := p.RemoveExpired(); n != 1 || p.Len() != 2 {
+				t.Fatalf("removed %d, len = %d", n, p.Len())
+			}
+		})
+	}
+}
+
+func TestPolicyCapacity(t *testing.T) {
+	for name, newPolicy := range policies {
+		t.Run(name, func(t *testing.T) {
+			const maxBytes = 1000
+			evictions := 0
+			p := newPolicy(maxBytes, func(key string, value Value, reason EvictReason) {
+				if reason != lru.EvictCapacity {
+					t.Fatalf("unexpected reason %v", reason)
+				}
+				evictions++
+			})
+			for i := 0; i < 1000; i++ {
+				p.AddWithExpire(fmt.Sprintf("key%04d", i), String("value"), time.Time{})
+				p.Get(fmt.Sprintf("key%04d", i%37))
+				if p.Bytes() > maxBytes {
+					t.Fatalf("bytes = %d, over %d", p.Bytes(), maxBytes)
+				}
+			}
+			if evictions+p.Len() != 1000 {
+				t.Fatalf("evictions %d + len %d != 1000", evictions, p.Len())
+			}
+		})
+	}
+}
+
+// 每一轮先访问两遍热点key，再扫描一批只访问一次的key，热点key和扫描的key加起来超过了缓存的容量。
+// LRU每一轮都会被扫描冲掉热点key，其他策略应该能留住它们
+func TestScanResistance(t *testing.T) {
+	const (
+		hot     = 10
+		scan    = 40
+		rounds  = 20
+		entries = 40
+	)
+	hitRate := func(newPolicy Factory) float64 {
+		// 每条记录 key 8字节 + value 8字节
+		p := newPolicy(entries*16, nil)
+		access := func(key string) bool {
+			if _, ok := p.Get(key); ok {
+				return true
+			}
+			p.AddWithExpire(key, String("01234567"), time.Time{})
+			return false
+		}
+		hits, total := 0, 0
+		next := 0
+		for r := 0; r < rounds; r++ {
+			for i := 0; i < hot; i++ {
+				key := fmt.Sprintf("hot%05d", i)
+				// 只统计每一轮第一次访问热点key，前两轮是预热
+				if access(key) && r >= 2 {
+					hits++
+				}
+				if r >= 2 {
+					total++
+				}
+				access(key)
+			}
+			for i := 0; i < scan; i++ {
+				access(fmt.Sprintf("scn%05d", next))
+				next++
+			}
+		}
+		return float64(hits) / float64(total)
+	}
+	if rate := hitRate(NewLRU); rate != 0 {
+		t.Fatalf("LRU hot hit rate = %.2f, want 0 for this workload", rate)
+	}
+	for name, newPolicy := range policies {
+		if name == "LRU" {
+			continue
+		}
+		if rate := hitRate(newPolicy); rate < 0.9 {
+			t.Errorf("%s hot hit rate = %.2f, want >= 0.9", name, rate)
+		}
+	}
+}
+
+func BenchmarkPolicies(b *testing.B) {
+	for name, newPolicy := range policies {
+		b.Run(name, func(b *testing.B) {
+			p := newPolicy(64<<10, nil)
+			keys := make([]string, 4096)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key%d", i)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := keys[i%len(keys)]
+				if _, ok := p.Get(key); !ok {
+					p.AddWithExpire(key, String("value"), time.Time{})
+				}
+			}
+		})
+	}
+}
+
+// 遍历的顺序是 p 的淘汰顺序
+func rangeKeys(p Policy) []string {
+	var keys []string
+	p.(Ranger).Range(func(key string, value Value, expire time.Time) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func TestPolicyRange(t *testing.T) {
+	for name, newPolicy := range policies {
+		t.Run(name, func(t *testing.T) {
+			p := newPolicy(0, nil)
+			for i := 0; i < 10; i++ {
+				p.AddWithExpire(fmt.Sprintf("k%d", i), String("v"), time.Time{})
+			}
+			p.AddWithExpire("expired", String("v"), time.Now().Add(-time.Second))
+			for i := 0; i < 10; i += 3 {
+				p.Get(fmt.Sprintf("k%d", i))
+			}
+			keys := rangeKeys(p)
+			seen := make(map[string]bool)
+			for _, key := range keys {
+				if seen[key] || key == "expired" {
+					t.Fatalf("Range visited %v", keys)
+				}
+				seen[key] = true
+			}
+			if len(keys) != 10 {
+				t.Fatalf("Range visited %d keys, want 10", len(keys))
+			}
+			// 按遍历顺序重新添加，LRU的顺序完全不变，其他策略只保证记录都在
+			restored := newPolicy(0, nil)
+			for _, key := range keys {
+				restored.AddWithExpire(key, String("v"), time.Time{})
+			}
+			got := rangeKeys(restored)
+			if name == "LRU" && fmt.Sprint(got) != fmt.Sprint(keys) {
+				t.Fatalf("Range after restore = %v, want %v", got, keys)
+			}
+			if len(got) != len(keys) {
+				t.Fatalf("Range after restore visited %d keys, want %d", len(got), len(keys))
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package eviction
+
+import (
+	"container/list"
+	"maps"
+	"mikucache/geecache/lru"
+	"slices"
+	"time"
+)
+
+// lfu 淘汰访问次数最少的记录，次数相同时淘汰最久没有访问的。
+// 每个访问次数对应一个队列，访问一次就把记录移到下一个次数的队列头部
+type lfu struct {
+	base
+	freqs   map[int]*queue
+	minFreq int // 可能偏小，淘汰时再修正
+}
+
+// NewLFU 创建一个LFU策略，只被扫描过一次的记录总是先被淘汰，不会冲掉经常访问的记录
+func NewLFU(maxBytes int64, onEvicted func(string, Value, EvictReason)) Policy {
+	return &lfu{base: newBase(maxBytes, onEvicted), freqs: make(map[int]*queue)}
+}
+
+func (c *lfu) queueOf(freq int) *queue {
+	q, ok := c.freqs[freq]
+	if !ok {
+		q = newQueue()
+		c.freqs[freq] = q
+	}
+	return q
+}
+
+// 访问次数加一
+func (c *lfu) touch(ele *list.Element) {
+	e := ele.Value.(*entry)
+	old := e.queue
+	e.freq++
+	c.move(ele, c.queueOf(e.freq))
+	if old.len() == 0 {
+		delete(c.freqs, e.freq-1)
+	}
+}
+
+func (c *lfu) AddWithExpire(key string, value Value, expire time.Time) {
+	var added *list.Element
+	if ele, ok := c.lookup(key); ok {
+		c.update(ele, value, expire)
+		c.touch(ele)
+	} else {
+		e := newEntry(key, value, expire)
+		e.freq = 1
+		c.insert(c.queueOf(1), e)
+		c.minFreq = 1
+		added = c.items[key]
+	}
+	// 刚加入的记录访问次数最少，除非只剩它自己，否则不淘汰它，不然它永远没有机会积累访问次数
+	for c.overflow() {
+		victim := c.victim(added)
+		if victim == nil {
+			victim = added
+		}
+		c.evict(victim, lru.EvictCapacity)
+	}
+}
+
+func (c *lfu) Get(key string) (Value, bool) {
+	ele, ok := c.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	c.touch(ele)
+	return ele.Value.(*entry).value, true
+}
+
+// Range 按访问次数从少到多遍历，次数相同时先遍历最久没有访问的
+func (c *lfu) Range(fn func(key string, value Value, expire time.Time) bool) {
+	freqs := slices.Sorted(maps.Keys(c.freqs))
+	for _, freq := range freqs {
+		if !rangeQueues(fn, c.freqs[freq]) {
+			return
+		}
+	}
+}
+
+// 返回访问次数最少的记录中最久没有访问的那个，跳过except
+func (c *lfu) victim(except *list.Element) *list.Element {
+	if q, ok := c.freqs[c.minFreq]; ok {
+		if ele := backExcept(q, except); ele != nil {
+			return ele
+		}
+	}
+	// minFreq对应的队列已经空了，重新找最小的访问次数，顺便清理空队列
+	var victim *list.Element
+	victimFreq := 0
+	c.minFreq = 0
+	for freq, q := range c.freqs {
+		if q.len() == 0 {
+			delete(c.freqs, freq)
+			continue
+		}
+		if c.minFreq == 0 || freq < c.minFreq {
+			c.minFreq = freq
+		}
+		if victimFreq != 0 && freq >= victimFreq {
+			continue
+		}
+		if ele := backExcept(q, except); ele != nil {
+			victimFreq, victim = freq, ele
+		}
+	}
+	return victim
+}
+
+func backExcept(q *queue, except *list.Element) *list.Element {
+	ele := q.ll.Back()
+	if ele != nil && ele == except {
+		ele = ele.Prev()
+	}
+	return ele
+}
@@ -0,0 +1,174 @@
+package eviction
+
+import (
+	"container/list"
+	"mikucache/geecache/lru"
+	"time"
+)
+
+// tinyLFU 是W-TinyLFU：新记录先进入占1%内存的窗口LRU，被挤出窗口时和主缓存中
+// 将要被淘汰的记录比较count-min sketch估计的访问频率，频率更高才能进入主缓存。
+// 主缓存是分段LRU：第一次进入时在probation，再次访问时晋升到占80%的protected
+type tinyLFU struct {
+	base
+	window       *queue
+	probation    *queue
+	protected    *queue
+	windowMax    int64
+	protectedMax int64
+	sketch       *sketch
+}
+
+// NewTinyLFU 创建一个W-TinyLFU策略
+func NewTinyLFU(maxBytes int64, onEvicted func(string, Value, EvictReason)) Policy {
+	windowMax := maxBytes / 100
+	// 按每条记录平均64字节估计sketch的宽度
+	width := 1 << 16
+	if maxBytes != 0 {
+		width = int(min(max(maxBytes/64, 256), 1<<20))
+	}
+	return &tinyLFU{
+		base:         newBase(maxBytes, onEvicted),
+		window:       newQueue(),
+		probation:    newQueue(),
+		protected:    newQueue(),
+		windowMax:    windowMax,
+		protectedMax: (maxBytes - windowMax) * 8 / 10,
+		sketch:       newSketch(width),
+	}
+}
+
+func (c *tinyLFU) AddWithExpire(key string, value Value, expire time.Time) {
+	c.sketch.add(key)
+	if ele, ok := c.lookup(key); ok {
+		c.update(ele, value, expire)
+		c.access(ele)
+	} else {
+		c.insert(c.window, newEntry(key, value, expire))
+	}
+	c.reclaim()
+}
+
+// Range 依次遍历window、probation和protected
+func (c *tinyLFU) Range(fn func(key string, value Value, expire time.Time) bool) {
+	rangeQueues(fn, c.window, c.probation, c.protected)
+}
+
+func (c *tinyLFU) Get(key string) (Value, bool) {
+	// 没有命中的访问也要计数，这样被拒绝过的热点记录下次才能进入主缓存
+	c.sketch.add(key)
+	ele, ok := c.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	c.access(ele)
+	return ele.Value.(*entry).value, true
+}
+
+func (c *tinyLFU) access(ele *list.Element) {
+	switch ele.Value.(*entry).queue {
+	case c.window:
+		c.move(ele, c.window)
+	case c.probation:
+		c.move(ele, c.protected)
+		// protected超出上限时，最久没有访问的记录降回probation
+		for c.protected.bytes > c.protectedMax && c.protected.len() > 1 {
+			c.move(c.protected.ll.Back(), c.probation)
+		}
+	case c.protected:
+		c.move(ele, c.protected)
+	}
+}
+
+func (c *tinyLFU) reclaim() {
+	for c.overflow() {
+		var candidate *list.Element
+		if c.window.bytes > c.windowMax {
+			candidate = c.window.ll.Back()
+		}
+		victim := c.probation.ll.Back()
+		if victim == nil {
+			victim = c.protected.ll.Back()
+		}
+		switch {
+		case candidate == nil:
+			c.evict(victim, lru.EvictCapacity)
+		case victim == nil:
+			c.move(candidate, c.probation)
+		case c.sketch.estimate(candidate.Value.(*entry).key) > c.sketch.estimate(victim.Value.(*entry).key):
+			c.evict(victim, lru.EvictCapacity)
+			c.move(candidate, c.probation)
+		default:
+			c.evict(candidate, lru.EvictCapacity)
+		}
+	}
+	// 没有超出总内存时，挤出窗口的记录直接进入probation，窗口里至少保留最新的一条
+	for c.window.bytes > c.windowMax && c.window.len() > 1 {
+		c.move(c.window.ll.Back(), c.probation)
+	}
+}
+
+// sketch 是4行的count-min sketch，每个计数器最大15，
+// 累计计数达到10倍宽度时所有计数器减半，让过去的热点逐渐冷却
+type sketch struct {
+	rows      [4][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newSketch(width int) *sketch {
+	// 宽度取2的幂，这样可以用位运算取模
+	size := 1
+	for size < width {
+		size <<= 1
+	}
+	s := &sketch{mask: uint64(size - 1), resetAt: 10 * size}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, size)
+	}
+	return s
+}
+
+// 第i行的下标，用两个哈希值组合出4个哈希函数
+func (s *sketch) index(h uint64, i int) uint64 {
+	h1, h2 := h, h>>32|1
+	return (h1 + uint64(i)*h2) & s.mask
+}
+
+func (s *sketch) add(key string) {
+	h := hashKey(key)
+	for i := range s.rows {
+		if idx := s.index(h, i); s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *sketch) estimate(key string) uint8 {
+	h := hashKey(key)
+	n := uint8(15)
+	for i := range s.rows {
+		n = min(n, s.rows[i][s.index(h, i)])
+	}
+	return n
+}
+
+// FNV-1a，避免每次调用hash/fnv都要分配内存
+func hashKey(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
@@ -0,0 +1,89 @@
+package eviction
+
+import (
+	"container/list"
+	"mikucache/geecache/lru"
+	"time"
+)
+
+// twoQueue 是2Q算法：新记录先进入FIFO队列in，被淘汰后key留在幽灵队列out中，
+// 在out中再次被加入时才进入LRU队列main。只访问一次的记录永远到不了main
+type twoQueue struct {
+	base
+	in, main *queue
+	out      *queue
+	ghosts   map[string]*list.Element
+	inMax    int64 // in的字节上限，maxBytes的1/4
+	outMax   int64 // out中幽灵记录原来大小的上限，maxBytes的1/2
+}
+
+// NewTwoQueue 创建一个2Q策略
+func NewTwoQueue(maxBytes int64, onEvicted func(string, Value, EvictReason)) Policy {
+	return &twoQueue{
+		base:   newBase(maxBytes, onEvicted),
+		in:     newQueue(),
+		main:   newQueue(),
+		out:    newQueue(),
+		ghosts: make(map[string]*list.Element),
+		inMax:  maxBytes / 4,
+		outMax: maxBytes / 2,
+	}
+}
+
+func (c *twoQueue) AddWithExpire(key string, value Value, expire time.Time) {
+	if ele, ok := c.lookup(key); ok {
+		c.update(ele, value, expire)
+		if ele.Value.(*entry).queue == c.main {
+			c.move(ele, c.main)
+		}
+		c.reclaim(0)
+		return
+	}
+	e := newEntry(key, value, expire)
+	to := c.in
+	if ghost, ok := c.ghosts[key]; ok {
+		c.removeGhost(ghost)
+		to = c.main
+	}
+	c.reclaim(e.bytes)
+	c.insert(to, e)
+}
+
+// Range 先遍历in，再遍历main，幽灵记录不包括在内
+func (c *twoQueue) Range(fn func(key string, value Value, expire time.Time) bool) {
+	rangeQueues(fn, c.in, c.main)
+}
+
+func (c *twoQueue) Get(key string) (Value, bool) {
+	ele, ok := c.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	// in是FIFO，短时间内的重复访问不算热点
+	if ele.Value.(*entry).queue == c.main {
+		c.move(ele, c.main)
+	}
+	return ele.Value.(*entry).value, true
+}
+
+// 腾出extra字节的空间，in超过上限时从in淘汰并记入out，否则从main淘汰
+func (c *twoQueue) reclaim(extra int64) {
+	for c.maxBytes != 0 && c.nbytes+extra > c.maxBytes && c.Len() > 0 {
+		if c.in.len() > 0 && (c.in.bytes > c.inMax || c.main.len() == 0) {
+			e := c.evict(c.in.ll.Back(), lru.EvictCapacity)
+			e.value = nil
+			c.ghosts[e.key] = c.out.pushFront(e)
+		} else {
+			c.evict(c.main.ll.Back(), lru.EvictCapacity)
+		}
+	}
+	for c.out.bytes > c.outMax && c.out.len() > 0 {
+		c.removeGhost(c.out.ll.Back())
+	}
+}
+
+func (c *twoQueue) removeGhost(ele *list.Element) {
+	e := ele.Value.(*entry)
+	e.queue.remove(ele)
+	delete(c.ghosts, e.key)
+}
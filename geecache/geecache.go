@@ -1,25 +1,153 @@
 package geecache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"math/rand/v2"
+	"mikucache/geecache/eviction"
 	"mikucache/geecache/geecachepb"
+	"mikucache/geecache/lru"
 	"mikucache/geecache/singleflight"
 	"sync"
+	"time"
 )
 
+// 从远程节点取回的值有 1/hotCacheRatio 的概率放进hotCache
+const hotCacheRatio = 10
+
 var (
 	mu     sync.RWMutex
 	groups = make(map[string]*Group)
 )
 
+// ErrNotFound 由Getter返回（可以用%w包装），表示key在数据源中不存在。
+// 配置了WithNegativeTTL时这个结果会被缓存，避免不存在的key每次都打到数据源上（缓存穿透）
+var ErrNotFound = errors.New("geecache: key not found")
+
 type Group struct {
 	name      string
 	getter    Getter
-	mainCache cache
-	peers     PeerPicker
+	setter    Setter // 可选的，Set时把值写回数据源
+	mainCache localCache
+	// 存放从远程节点取回的热点数据，避免热点key每次都要走网络
+	hotCache localCache
+	peers    PeerPicker
 	// 使用singleflight.Group确保并发场景下针对相同的key，load过程只会调用一次
 	loader *singleflight.Group
+	// 本地加载的值的默认存活时间，0表示永不过期；Getter实现了TTLGetter或ContextTTLGetter时以它返回的为准
+	ttl time.Duration
+	// 可选的，缓存未命中时先用它排除一定不存在的key
+	filter KeyFilter
+	// 不存在的key的缓存时间，0表示不缓存
+	negativeTTL time.Duration
+	// 后台清理过期记录的间隔，0表示不启动清理，只在Get时惰性过期
+	janitorInterval time.Duration
+	// 删除key时，是否由负责这个key的节点通知其他所有节点一起删除（包括它们的hotCache）
+	broadcast bool
+	// 统计数据
+	Stats Stats
+	// getLocally和getFromPeer的耗时
+	localLoadLatency histogram
+	peerLoadLatency  histogram
+	// 以下由GroupOption设置，NewGroup用它们创建mainCache和hotCache
+	hotCacheBytes int64
+	newPolicy     eviction.Factory
+	onEvicted     func(key string, value ByteView, reason lru.EvictReason)
+	shards        int
+	// 快照文件的路径和定期保存的间隔，见WithSnapshot
+	snapshotPath     string
+	snapshotInterval time.Duration
+	// 可选的第二级缓存，见WithL2Cache
+	l2      L2Cache
+	l2Queue *l2Queue
+	// 其他节点和客户端的访问权限，为nil时不限制，见WithPolicy
+	policy Policy
+}
+
+// GroupOption 用来在NewGroup时配置Group
+type GroupOption func(*Group)
+
+// WithTTL 设置本地加载的值的默认存活时间
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// WithNegativeTTL 缓存Getter返回ErrNotFound的结果ttl时间，在这段时间内再次Get这个key直接返回ErrNotFound
+func WithNegativeTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.negativeTTL = ttl
+	}
+}
+
+// KeyFilter 判断key是否可能存在，返回false表示key一定不存在，bloom包中的过滤器都实现了它
+type KeyFilter interface {
+	Test(key string) bool
+}
+
+// WithKeyFilter 设置key过滤器，缓存未命中时如果过滤器判断key一定不存在，
+// 直接返回ErrNotFound，不会访问远程节点和数据源。过滤器需要由调用方预先装入所有合法的key；
+// 过滤器还有Add(key string)方法时，Set写入的key会被自动加入
+func WithKeyFilter(filter KeyFilter) GroupOption {
+	return func(g *Group) {
+		g.filter = filter
+	}
+}
+
+// WithJanitor 启动一个后台goroutine，每隔interval清理一次过期记录
+func WithJanitor(interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.janitorInterval = interval
+	}
+}
+
+// WithHotCacheBytes 设置hotCache的内存上限，默认是cacheBytes的1/8，0表示不使用hotCache
+func WithHotCacheBytes(bytes int64) GroupOption {
+	return func(g *Group) {
+		g.hotCacheBytes = bytes
+	}
+}
+
+// WithBroadcastInvalidation 删除key时由负责这个key的节点把失效广播给其他所有节点，
+// 这样其他节点hotCache中的副本也会被删除；PeerPicker需要实现PeerLister
+func WithBroadcastInvalidation() GroupOption {
+	return func(g *Group) {
+		g.broadcast = true
+	}
+}
+
+// WithSetter 设置Set时的写穿(write-through)目标，值先写入数据源，成功后才写入缓存
+func WithSetter(setter Setter) GroupOption {
+	return func(g *Group) {
+		g.setter = setter
+	}
+}
+
+// WithOnEvicted 设置记录被清除时的回调，回调在持有缓存锁时执行，不能再访问这个Group
+func WithOnEvicted(fn func(key string, value ByteView, reason lru.EvictReason)) GroupOption {
+	return func(g *Group) {
+		g.onEvicted = fn
+	}
+}
+
+// WithEvictionPolicy 设置mainCache和hotCache的淘汰策略，默认是LRU，
+// 比如 WithEvictionPolicy(eviction.NewTinyLFU)，扫描较多的场景下可以避免热点数据被冲掉
+func WithEvictionPolicy(newPolicy eviction.Factory) GroupOption {
+	return func(g *Group) {
+		g.newPolicy = newPolicy
+	}
+}
+
+// WithShards 把mainCache和hotCache各自分成n个独立加锁的分片，内存上限平均分给每个分片，
+// 读多的场景下可以减少锁竞争；n<=1时不分片
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.shards = n
+	}
 }
 
 // 缓存不存在的时候，调用这个接口，获取源数据
@@ -32,17 +160,98 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+// 调用Group.Set时，用这个接口把值写回数据源
+type Setter interface {
+	Set(key string, value []byte) error
+}
+type SetterFunc func(key string, value []byte) error
+
+func (f SetterFunc) Set(key string, value []byte) error {
+	return f(key, value)
+}
+
+// ContextGetter 是带ctx的Getter，ctx被取消说明所有等待这个key的请求都已经放弃了
+type ContextGetter interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// 实现Getter接口，这样ContextGetterFunc也能直接传给NewGroup
+func (f ContextGetterFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+// TTLGetter 在返回源数据的同时返回它的存活时间，ttl<=0表示永不过期
+type TTLGetter interface {
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+type TTLGetterFunc func(key string) ([]byte, time.Duration, error)
+
+func (f TTLGetterFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
+// 实现Getter接口，这样TTLGetterFunc也能直接传给NewGroup
+func (f TTLGetterFunc) Get(key string) ([]byte, error) {
+	bytes, _, err := f(key)
+	return bytes, err
+}
+
+// ContextTTLGetter 同时需要ctx和存活时间时实现这个接口，优先级最高
+type ContextTTLGetter interface {
+	GetWithTTLContext(ctx context.Context, key string) ([]byte, time.Duration, error)
+}
+type ContextTTLGetterFunc func(ctx context.Context, key string) ([]byte, time.Duration, error)
+
+func (f ContextTTLGetterFunc) GetWithTTLContext(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	return f(ctx, key)
+}
+
+// 实现Getter接口，这样ContextTTLGetterFunc也能直接传给NewGroup
+func (f ContextTTLGetterFunc) Get(key string) ([]byte, error) {
+	bytes, _, err := f(context.Background(), key)
+	return bytes, err
+}
+
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
 	mu.Lock()
 	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    singleflight.NewGroup(),
+		name:          name,
+		getter:        getter,
+		hotCacheBytes: cacheBytes / 8,
+		loader:        singleflight.NewGroup(),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	onEvicted := g.onEvicted
+	if g.l2 != nil {
+		g.l2Queue = newL2Queue()
+		go g.writeL2()
+		onEvicted = g.evictToL2(onEvicted)
+	}
+	g.mainCache = newLocalCache(cacheBytes, g.shards, g.newPolicy, onEvicted)
+	g.hotCache = newLocalCache(g.hotCacheBytes, g.shards, g.newPolicy, nil)
+	if g.janitorInterval > 0 {
+		go janitor(g.mainCache, g.janitorInterval)
+		go janitor(g.hotCache, g.janitorInterval)
+	}
+	if g.snapshotPath != "" {
+		// 重启之后先用快照预热，第一次启动时还没有快照文件
+		if err := g.RestoreFile(g.snapshotPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Println("[MikuCache] Failed to restore snapshot", err)
+		}
+		if g.snapshotInterval > 0 {
+			go snapshotter(g, g.snapshotPath, g.snapshotInterval)
+		}
 	}
 	groups[name] = g
 	return g
@@ -56,50 +265,282 @@ func GetGroup(name string) *Group {
 }
 
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 和 Get 一样，ctx被取消或超时时立即返回ctx.Err()
+// 相同key的并发请求共享同一次加载，只有所有请求都放弃时才会取消这次加载
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
-	// 从mainCache中查找缓存，如果存在则返回缓存值
-	if v, ok := g.mainCache.get(key); ok {
+	g.Stats.Gets.Add(1)
+	// 从mainCache和hotCache中查找缓存，如果存在则返回缓存值
+	if v, ok := g.lookupCache(key); ok {
 		log.Println("[GeeCache] hit")
-		return v, nil
+		g.Stats.CacheHits.Add(1)
+		return v.result(key)
+	}
+	if g.filter != nil && !g.filter.Test(key) {
+		g.Stats.FilterRejects.Add(1)
+		return ByteView{}, fmt.Errorf("%s: %w", key, ErrNotFound)
 	}
-	// mainCache中找不到就去load
-	return g.load(key)
+	// 缓存中找不到就去load
+	return g.load(ctx, key)
 }
-func (g *Group) load(key string) (value ByteView, err error) {
+
+func (g *Group) lookupCache(key string) (ByteView, bool) {
+	if v, ok := g.mainCache.get(key); ok {
+		return v, true
+	}
+	return g.hotCache.get(key)
+}
+func (g *Group) load(ctx context.Context, key string) (ByteView, error) {
+	g.Stats.Loads.Add(1)
 	// 每个key只请求一次 不管是本地还是远程
 	// 并发场景下针对相同的key，load过程只会调用一次
-	view, err := g.loader.Do(key, func() (any, error) {
-		if g.peers != nil {
+	view, err := g.loader.DoContext(ctx, key, func(ctx context.Context) (any, error) {
+		// 可能刚好有另一次load结束并把值放进了缓存，这次Get已经算作load，不再算作CacheHits
+		if v, ok := g.lookupCache(key); ok {
+			g.Stats.RecheckHits.Add(1)
+			return v, nil
+		}
+		g.Stats.LoadsDeduped.Add(1)
+		// 内存中被淘汰的值可能还在L2Cache中
+		if v, ok := g.lookupL2(key); ok {
+			return v, nil
+		}
+		if owners := g.replicas(key); owners != nil {
+			// 开启了复制，依次尝试key的每个副本节点
+			if value, ok, err := g.loadFromReplicas(ctx, key, owners); ok {
+				return value, err
+			}
+		} else if g.peers != nil {
 			// 先根据key选择对应的peer
 			if peer, ok := g.peers.PickPeer(key); ok {
 				// 然后从这个peer取出结果
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
+				start := time.Now()
+				value, err := g.getFromPeer(ctx, peer, key)
+				g.peerLoadLatency.observe(time.Since(start))
+				// 远程节点确认key不存在时，不再从本地数据源加载
+				if err == nil || errors.Is(err, ErrNotFound) {
+					g.Stats.PeerLoads.Add(1)
+					return value, err
 				}
+				g.Stats.PeerErrors.Add(1)
 				log.Println("[MikuCache] Failed to get from peer", err)
 			}
 		}
 		// 取本地的了
-		return g.getLocally(key)
+		start := time.Now()
+		value, err := g.getLocally(ctx, key)
+		g.localLoadLatency.observe(time.Since(start))
+		g.recordLocalLoad(err)
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
 	})
-	if err == nil {
-		return view.(ByteView), nil
+	if err != nil {
+		return ByteView{}, err
+	}
+	return view.(ByteView).result(key)
+}
+
+// 统计一次本地加载，key不存在说明数据源正常返回了结果，不算加载失败
+func (g *Group) recordLocalLoad(err error) {
+	switch {
+	case err == nil:
+		g.Stats.LocalLoads.Add(1)
+	case !errors.Is(err, ErrNotFound):
+		g.Stats.LocalLoadErrs.Add(1)
 	}
-	return
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
 	// 通过getter方法去获取key对应的value
-	bytes, err := g.getter.Get(key)
+	var (
+		bytes []byte
+		ttl   = g.ttl
+		err   error
+	)
+	// 先检查更具体的接口：同时实现ContextGetter和TTLGetter时不能丢掉ttl
+	switch getter := g.getter.(type) {
+	case ContextTTLGetter:
+		bytes, ttl, err = getter.GetWithTTLContext(ctx, key)
+	case TTLGetter:
+		bytes, ttl, err = getter.GetWithTTL(key)
+	case ContextGetter:
+		bytes, err = getter.GetContext(ctx, key)
+	default:
+		bytes, err = getter.Get(key)
+	}
 	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			g.populateNotFound(key)
+		}
 		return ByteView{}, err
 	}
+	value := g.populateLocal(key, bytes, ttl)
+	g.pushToReplicasAsync(ctx, key, value)
+	return value, nil
+}
+
+// 把从数据源加载的值放进缓存，ttl<=0表示永不过期
+func (g *Group) populateLocal(key string, bytes []byte, ttl time.Duration) ByteView {
 	value := ByteView{b: cloneBytes(bytes)}
+	if ttl > 0 {
+		value.e = time.Now().Add(ttl)
+	}
 	// 将key和value添加到缓存中
 	g.populateCache(key, value)
-	return value, nil
+	return value
+}
+
+// 配置了WithNegativeTTL时缓存key不存在的结果
+func (g *Group) populateNotFound(key string) {
+	if g.negativeTTL > 0 {
+		g.populateCache(key, ByteView{e: time.Now().Add(g.negativeTTL), notFound: true})
+	}
+}
+
+// Remove 删除key对应的缓存值，负责这个key的节点是远程节点时会通知它删除
+func (g *Group) Remove(key string) error {
+	return g.RemoveContext(context.Background(), key)
+}
+
+func (g *Group) RemoveContext(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	g.removeLocally(key)
+	// 开启了复制时每个副本节点都要删除，广播会通知所有节点，不需要单独处理
+	if owners := g.replicas(key); owners != nil && !g.broadcast {
+		return g.removeFromReplicas(ctx, key, owners)
+	}
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			return peer.Delete(ctx, &geecachepb.DeleteRequest{
+				Group:     g.name,
+				Key:       key,
+				Broadcast: g.broadcast,
+			})
+		}
+	}
+	// 自己就是负责这个key的节点
+	if g.broadcast {
+		return g.broadcastRemove(ctx, key)
+	}
+	return nil
+}
+
+// 处理其他节点发来的删除请求
+func (g *Group) removeFromPeer(ctx context.Context, in *geecachepb.DeleteRequest) error {
+	g.removeLocally(in.GetKey())
+	if in.GetBroadcast() {
+		return g.broadcastRemove(ctx, in.GetKey())
+	}
+	return nil
+}
+
+func (g *Group) removeLocally(key string) {
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+	g.removeFromL2(key)
+}
+
+// 通知其他所有节点删除key，收到通知的节点不会再继续广播
+func (g *Group) broadcastRemove(ctx context.Context, key string) error {
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+	peers := lister.AllPeers()
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = peer.Delete(ctx, &geecachepb.DeleteRequest{Group: g.name, Key: key})
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Set 写入key对应的值，负责这个key的节点是远程节点时，转发给它写入
+func (g *Group) Set(key string, value []byte) error {
+	return g.SetContext(context.Background(), key, value)
+}
+
+func (g *Group) SetContext(ctx context.Context, key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	view := ByteView{b: cloneBytes(value)}
+	if g.ttl > 0 {
+		view.e = time.Now().Add(g.ttl)
+	}
+	g.addToFilter(key)
+	if g.peers != nil {
+		if peer, ok := g.peers.PickPeer(key); ok {
+			// 本地可能还留着旧值的副本
+			g.removeLocally(key)
+			return peer.Set(ctx, &geecachepb.SetRequest{
+				Group:  g.name,
+				Key:    key,
+				Value:  view.b,
+				Expire: expireToProto(view.e),
+			})
+		}
+	}
+	return g.setLocally(ctx, key, view)
+}
+
+// 处理其他节点转发过来的写入请求
+func (g *Group) setFromPeer(ctx context.Context, in *geecachepb.SetRequest) error {
+	value := ByteView{b: cloneBytes(in.GetValue()), e: expireFromProto(in.GetExpire())}
+	if in.GetReplica() {
+		// 主节点推送过来的副本，已经写过数据源了
+		g.populateReplica(in.GetKey(), value)
+		return nil
+	}
+	return g.setLocally(ctx, in.GetKey(), value)
+}
+
+// 其他节点推送过来的值只放进缓存，不写穿数据源
+func (g *Group) populateReplica(key string, value ByteView) {
+	g.addToFilter(key)
+	g.hotCache.remove(key)
+	g.removeFromL2(key)
+	g.populateCache(key, value)
+}
+
+// 自己负责这个key，先写穿到数据源，再放进缓存
+func (g *Group) setLocally(ctx context.Context, key string, value ByteView) error {
+	if g.setter != nil {
+		if err := g.setter.Set(key, value.ByteSlice()); err != nil {
+			return err
+		}
+	}
+	g.addToFilter(key)
+	g.hotCache.remove(key)
+	g.removeFromL2(key)
+	g.populateCache(key, value)
+	// 其他节点hotCache中的旧值也要失效，要在推送副本之前，否则副本也会被删掉
+	var err error
+	if g.broadcast {
+		err = g.broadcastRemove(ctx, key)
+	}
+	return errors.Join(err, g.pushToReplicas(ctx, key, value))
+}
+
+// 新写入的key加入过滤器，否则之后Get会被过滤器拒绝
+func (g *Group) addToFilter(key string) {
+	if f, ok := g.filter.(interface{ Add(key string) }); ok {
+		f.Add(key)
+	}
 }
 
 // 将key和value添加到缓存中
@@ -108,6 +549,18 @@ func (g *Group) populateCache(key string, value ByteView) {
 	g.mainCache.add(key, value)
 }
 
+// CacheStats 返回指定缓存的统计数据
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	default:
+		return CacheStats{}
+	}
+}
+
 // 注册Peer
 func (g *Group) RegisterPeers(peers PeerPicker) {
 	// 不能注册一次以上
@@ -118,15 +571,36 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 }
 
 // 从peer取数据
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
+	value, err := g.fetchFromPeer(ctx, peer, key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	g.maybePopulateHot(key, value)
+	return value, nil
+}
+
+// 从peer取数据，不放进缓存
+func (g *Group) fetchFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &geecachepb.Request{
 		Group: g.name,
 		Key:   key,
 	}
 	res := &geecachepb.Response{}
-	err := peer.Get(req, res)
+	err := peer.GetContext(ctx, req, res)
 	if err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{b: res.Value}, nil
+	value := viewFromResponse(res)
+	if value.notFound {
+		return ByteView{}, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return value, nil
+}
+
+// 只按一定概率放进hotCache，真正的热点key很快就会被放进来，冷key则不会挤占hotCache
+func (g *Group) maybePopulateHot(key string, value ByteView) {
+	if g.hotCacheBytes > 0 && rand.IntN(hotCacheRatio) == 0 {
+		g.hotCache.add(key, value)
+	}
 }
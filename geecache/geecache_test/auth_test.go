@@ -0,0 +1,296 @@
+package geecache_test
+
+import (
+	"context"
+	"errors"
+	"mikucache/geecache"
+	"mikucache/geecache/geecachepb"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 每个调用方一个token
+var authTokens = map[string]string{
+	"t-reader": "reader",
+	"t-writer": "writer",
+	"t-admin":  "admin",
+}
+
+func init() {
+	geecache.NewGroup("auth-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("value-" + key), nil
+		},
+	), geecache.WithPolicy(geecache.ACL{
+		"reader": geecache.PermRead,
+		"writer": geecache.PermRead | geecache.PermWrite,
+		"admin":  geecache.PermAll,
+	}))
+}
+
+// 依次执行读、写、删除，返回每一步的错误
+func readWriteDelete(peer geecache.PeerGetter) [3]error {
+	ctx := context.Background()
+	res := &geecachepb.Response{}
+	return [3]error{
+		peer.GetContext(ctx, &geecachepb.Request{Group: "auth-scores", Key: "Tom"}, res),
+		peer.Set(ctx, &geecachepb.SetRequest{Group: "auth-scores", Key: "Tom", Value: []byte("v")}),
+		peer.Delete(ctx, &geecachepb.DeleteRequest{Group: "auth-scores", Key: "Tom"}),
+	}
+}
+
+func TestHTTPPoolAuth(t *testing.T) {
+	srv := httptest.NewServer(geecache.NewHTTPPool("http://server",
+		geecache.WithAuthenticator(geecache.NewBearerAuth("", authTokens))))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		token string
+		want  [3]int // 读、写、删除的状态码，0表示成功
+	}{
+		{"", [3]int{401, 401, 401}},
+		{"t-unknown", [3]int{401, 401, 401}},
+		{"t-reader", [3]int{0, 403, 403}},
+		{"t-writer", [3]int{0, 0, 403}},
+		{"t-admin", [3]int{0, 0, 0}},
+	} {
+		var opts []geecache.HTTPPoolOption
+		if tt.token != "" {
+			opts = append(opts, geecache.WithAuthenticator(geecache.NewBearerAuth(tt.token, nil)))
+		}
+		client := geecache.NewHTTPPool("http://local", opts...)
+		client.Set(srv.URL)
+		peer, _ := client.PickPeer("Tom")
+		for i, err := range readWriteDelete(peer) {
+			want := tt.want[i]
+			if (err == nil) != (want == 0) || (err != nil && !strings.Contains(err.Error(), http.StatusText(want))) {
+				t.Fatalf("token %q: step %d = %v, want status %d", tt.token, i, err, want)
+			}
+		}
+	}
+}
+
+func TestHTTPPoolTransferAuth(t *testing.T) {
+	srv := httptest.NewServer(geecache.NewHTTPPool("http://server",
+		geecache.WithAuthenticator(geecache.NewBearerAuth("", authTokens))))
+	defer srv.Close()
+
+	in := &geecachepb.TransferRequest{
+		Group:   "auth-scores",
+		Entries: []*geecachepb.SetRequest{{Group: "auth-scores", Key: "Moved", Value: []byte("v")}},
+	}
+	for token, wantErr := range map[string]bool{"t-reader": true, "t-writer": false} {
+		client := geecache.NewHTTPPool("http://local",
+			geecache.WithAuthenticator(geecache.NewBearerAuth(token, nil)))
+		client.Set(srv.URL)
+		peer, _ := client.PickPeer("Moved")
+		err := peer.(geecache.Transferrer).Transfer(context.Background(), in)
+		if (err != nil) != wantErr {
+			t.Fatalf("%s: Transfer = %v, want error %v", token, err, wantErr)
+		}
+	}
+}
+
+func TestGRPCPoolAuth(t *testing.T) {
+	secret := []byte("cluster-secret")
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := geecache.NewGRPCPool(lis.Addr().String(),
+		geecache.WithGRPCAuthenticator(geecache.NewHMACAuth("server", secret)))
+	go server.Serve(lis)
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name string
+		auth geecache.Authenticator
+		want [3]codes.Code
+	}{
+		{"no credentials", nil, [3]codes.Code{codes.Unauthenticated, codes.Unauthenticated, codes.Unauthenticated}},
+		{"wrong secret", geecache.NewHMACAuth("admin", []byte("guess")), [3]codes.Code{codes.Unauthenticated, codes.Unauthenticated, codes.Unauthenticated}},
+		{"reader", geecache.NewHMACAuth("reader", secret), [3]codes.Code{codes.OK, codes.PermissionDenied, codes.PermissionDenied}},
+		{"admin", geecache.NewHMACAuth("admin", secret), [3]codes.Code{codes.OK, codes.OK, codes.OK}},
+	} {
+		var opts []geecache.GRPCPoolOption
+		if tt.auth != nil {
+			opts = append(opts, geecache.WithGRPCAuthenticator(tt.auth))
+		}
+		client := geecache.NewGRPCPool("127.0.0.1:1", opts...)
+		client.Set(lis.Addr().String())
+		peer, _ := client.PickPeer("Tom")
+		got := readWriteDelete(peer)
+		client.Close()
+		for i, err := range got {
+			if status.Code(err) != tt.want[i] {
+				t.Fatalf("%s: step %d = %v, want %v", tt.name, i, err, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	ctx := context.Background()
+	secret := []byte("cluster-secret")
+	// 节点地址中有冒号，认证之后仍然是完整的名字
+	node := geecache.NewHMACAuth("http://localhost:8001", secret)
+	token, err := node.Token(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caller, err := geecache.NewHMACAuth("http://localhost:8002", secret).Authenticate(ctx, token)
+	if err != nil || caller != "http://localhost:8001" {
+		t.Fatalf("Authenticate = %q, %v", caller, err)
+	}
+
+	// 篡改名字、时间戳或者使用其他密钥都会失败
+	for _, bad := range []string{
+		strings.Replace(token, "8001", "8003", 1),
+		strings.Replace(token, ":1", ":2", 1),
+		"Bearer " + token,
+	} {
+		if _, err = node.Authenticate(ctx, bad); !errors.Is(err, geecache.ErrUnauthenticated) {
+			t.Fatalf("Authenticate(%q) = %v, want ErrUnauthenticated", bad, err)
+		}
+	}
+	if _, err = geecache.NewHMACAuth("x", []byte("other")).Authenticate(ctx, token); !errors.Is(err, geecache.ErrUnauthenticated) {
+		t.Fatalf("token signed with another secret: %v", err)
+	}
+}
+
+func TestGroupAuthorize(t *testing.T) {
+	g := geecache.GetGroup("auth-scores")
+	if err := g.Authorize("writer", geecache.PermRead|geecache.PermWrite); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Authorize("writer", geecache.PermDelete); !errors.Is(err, geecache.ErrPermissionDenied) {
+		t.Fatalf("writer delete = %v, want ErrPermissionDenied", err)
+	}
+	if err := g.Authorize("", geecache.PermRead); !errors.Is(err, geecache.ErrPermissionDenied) {
+		t.Fatalf("anonymous read = %v, want ErrPermissionDenied", err)
+	}
+	// 没有设置Policy的Group不限制
+	if err := geecache.GetGroup("tls-scores").Authorize("", geecache.PermAll); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClusterPolicy(t *testing.T) {
+	tokens := map[string]string{"t-victim": "http://victim", "t-reader": "reader", "t-nobody": "nobody"}
+	pool := geecache.NewHTTPPool("http://node",
+		geecache.WithAuthenticator(geecache.NewBearerAuth("", tokens)),
+		geecache.WithClusterPolicy(geecache.ACL{"http://victim": geecache.PermRead, "reader": geecache.PermRead}))
+	pool.Set("http://node", "http://victim")
+	mux := http.NewServeMux()
+	mux.Handle("/_geecache/", pool)
+	mux.Handle("/metrics", pool.Guard(geecache.PermRead, geecache.NewMetricsHandler(pool)))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	do := func(method, path, token, body string) int {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	// 只有读权限的节点即使为自己发离开通知也会被拒绝
+	if code := do(http.MethodPost, "/_geecache/_leave", "t-victim", "http://victim"); code != http.StatusForbidden {
+		t.Fatalf("leave without membership permission = %d, want 403", code)
+	}
+	for token, want := range map[string]int{"": 401, "t-nobody": 403, "t-reader": 200} {
+		if code := do(http.MethodGet, "/metrics", token, ""); code != want {
+			t.Fatalf("metrics with %q = %d, want %d", token, code, want)
+		}
+	}
+}
+
+// 集群的权限：推送副本和转移key需要集群的PermWrite，不存在的Group也按它检查
+var peerOnlyPolicy = geecache.ACL{"writer": geecache.PermRead, "admin": geecache.PermAll}
+
+// 依次执行普通写入、推送副本、转移key、读不存在的Group，返回每一步的错误
+func peerOnlyCalls(peer geecache.PeerGetter) [4]error {
+	ctx := context.Background()
+	set := &geecachepb.SetRequest{Group: "auth-scores", Key: "Tom", Value: []byte("v")}
+	replica := &geecachepb.SetRequest{Group: "auth-scores", Key: "Tom", Value: []byte("v"), Replica: true}
+	return [4]error{
+		peer.Set(ctx, set),
+		peer.Set(ctx, replica),
+		peer.(geecache.Transferrer).Transfer(ctx, &geecachepb.TransferRequest{Group: "auth-scores", Entries: []*geecachepb.SetRequest{replica}}),
+		peer.GetContext(ctx, &geecachepb.Request{Group: "no-such-scores", Key: "Tom"}, &geecachepb.Response{}),
+	}
+}
+
+var peerOnlyWant = map[string][4]string{
+	"reader": {"denied", "denied", "denied", "denied"},
+	"writer": {"ok", "denied", "denied", "missing"},
+	"admin":  {"ok", "ok", "ok", "missing"},
+}
+
+func TestHTTPPoolPeerOnly(t *testing.T) {
+	srv := httptest.NewServer(geecache.NewHTTPPool("http://server",
+		geecache.WithAuthenticator(geecache.NewBearerAuth("", authTokens)),
+		geecache.WithClusterPolicy(peerOnlyPolicy)))
+	defer srv.Close()
+
+	kind := func(err error) string {
+		switch {
+		case err == nil:
+			return "ok"
+		case strings.Contains(err.Error(), http.StatusText(http.StatusForbidden)):
+			return "denied"
+		case strings.Contains(err.Error(), http.StatusText(http.StatusNotFound)):
+			return "missing"
+		}
+		return err.Error()
+	}
+	for name, want := range peerOnlyWant {
+		client := geecache.NewHTTPPool("http://local",
+			geecache.WithAuthenticator(geecache.NewBearerAuth("t-"+name, nil)))
+		client.Set(srv.URL)
+		peer, _ := client.PickPeer("Tom")
+		for i, err := range peerOnlyCalls(peer) {
+			if got := kind(err); got != want[i] {
+				t.Fatalf("%s: step %d = %s, want %s", name, i, got, want[i])
+			}
+		}
+	}
+}
+
+func TestGRPCPoolPeerOnly(t *testing.T) {
+	secret := []byte("cluster-secret")
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := geecache.NewGRPCPool(lis.Addr().String(),
+		geecache.WithGRPCAuthenticator(geecache.NewHMACAuth("server", secret)),
+		geecache.WithGRPCClusterPolicy(peerOnlyPolicy))
+	go server.Serve(lis)
+	defer server.Close()
+
+	kinds := map[codes.Code]string{codes.OK: "ok", codes.PermissionDenied: "denied", codes.NotFound: "missing"}
+	for name, want := range peerOnlyWant {
+		client := geecache.NewGRPCPool("127.0.0.1:1", geecache.WithGRPCAuthenticator(geecache.NewHMACAuth(name, secret)))
+		client.Set(lis.Addr().String())
+		peer, _ := client.PickPeer("Tom")
+		got := peerOnlyCalls(peer)
+		client.Close()
+		for i, err := range got {
+			if kinds[status.Code(err)] != want[i] {
+				t.Fatalf("%s: step %d = %v, want %s", name, i, err, want[i])
+			}
+		}
+	}
+}
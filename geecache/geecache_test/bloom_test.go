@@ -0,0 +1,44 @@
+package geecache_test
+
+import (
+	"errors"
+	"mikucache/geecache"
+	"mikucache/geecache/bloom"
+	"sync/atomic"
+	"testing"
+)
+
+func TestKeyFilter(t *testing.T) {
+	var loads int32
+	filter := bloom.NewScalable(100, 0.01)
+	for key := range db {
+		filter.Add(key)
+	}
+	gee := geecache.NewGroup("bloom-scores", 2<<10, notFoundGetter(&loads), geecache.WithKeyFilter(filter))
+	peer := &fakePeer{}
+	gee.RegisterPeers(peer)
+
+	for i := 0; i < 3; i++ {
+		if _, err := gee.Get("unknown"); !errors.Is(err, geecache.ErrNotFound) {
+			t.Fatalf("get unknown err = %v, want ErrNotFound", err)
+		}
+	}
+	// 被过滤器拒绝的key既不访问远程节点也不访问数据源
+	if atomic.LoadInt32(&peer.gets) != 0 || atomic.LoadInt32(&loads) != 0 {
+		t.Fatalf("peer gets = %d, loads = %d, want 0", peer.gets, loads)
+	}
+	if n := gee.Stats.FilterRejects.Get(); n != 3 {
+		t.Fatalf("filter rejects = %d, want 3", n)
+	}
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "remote-Tom" {
+		t.Fatalf("get Tom = %s, %v", view, err)
+	}
+
+	// Set写入的key会被加入过滤器
+	if err := gee.Set("Lucy", []byte("600")); err != nil {
+		t.Fatal(err)
+	}
+	if !filter.Test("Lucy") {
+		t.Fatal("Lucy should be added to the filter by Set")
+	}
+}
@@ -0,0 +1,138 @@
+package geecache_test
+
+import (
+	"errors"
+	"fmt"
+	"mikucache/geecache"
+	"mikucache/geecache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	geecache.NewGroup("breaker-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("value-" + key), nil
+		},
+	))
+}
+
+// 前failures次请求返回503，之后交给真正的HTTPPool处理
+func flakyServer(t *testing.T, failures int32) (*httptest.Server, *int32) {
+	var requests int32
+	pool := geecache.NewHTTPPool("http://server")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		pool.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func getFrom(pool *geecache.HTTPPool, key string) error {
+	peer, ok := pool.PickPeer(key)
+	if !ok {
+		return fmt.Errorf("%s was not picked to a remote peer", key)
+	}
+	res := &geecachepb.Response{}
+	if err := peer.Get(&geecachepb.Request{Group: "breaker-scores", Key: key}, res); err != nil {
+		return err
+	}
+	if string(res.GetValue()) != "value-"+key {
+		return fmt.Errorf("get %s = %s", key, res.GetValue())
+	}
+	return nil
+}
+
+func TestHTTPRetries(t *testing.T) {
+	srv, requests := flakyServer(t, 2)
+	pool := geecache.NewHTTPPool("http://local", geecache.WithRetries(2, time.Millisecond))
+	pool.Set(srv.URL)
+	if err := getFrom(pool, "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Fatalf("requests = %d, want 3", n)
+	}
+}
+
+func TestHTTPTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	pool := geecache.NewHTTPPool("http://local", geecache.WithHTTPTimeout(20*time.Millisecond))
+	pool.Set(srv.URL)
+	start := time.Now()
+	if err := getFrom(pool, "Tom"); err == nil {
+		t.Fatal("get from a hanging peer should time out")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("timeout took %v", elapsed)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	srv, requests := flakyServer(t, 2)
+	pool := geecache.NewHTTPPool("http://local", geecache.WithCircuitBreaker(2, 50*time.Millisecond))
+	pool.Set(srv.URL)
+	for i := 0; i < 5; i++ {
+		err := getFrom(pool, "Tom")
+		if i >= 2 && !errors.Is(err, geecache.ErrCircuitOpen) {
+			t.Fatalf("request %d err = %v, want ErrCircuitOpen", i, err)
+		}
+	}
+	// 熔断之后请求不再发到远程节点
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Fatalf("requests = %d, want 2", n)
+	}
+	// 冷却结束后放行试探请求，节点已经恢复，熔断器关闭
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err := getFrom(pool, "Tom"); err != nil {
+			t.Fatalf("request after cooldown: %v", err)
+		}
+	}
+}
+
+func TestRerouting(t *testing.T) {
+	dead, _ := flakyServer(t, 1<<30)
+	alive, _ := flakyServer(t, 0)
+	pool := geecache.NewHTTPPool("http://local",
+		geecache.WithCircuitBreaker(1, time.Minute), geecache.WithRerouting())
+	pool.Set(dead.URL, alive.URL)
+
+	// 找一个由dead负责的key：dead熔断之前请求它会失败
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if err := getFrom(pool, key); err == nil {
+			continue
+		}
+		// dead已经熔断，key被转到哈希环上的下一个节点alive
+		if err := getFrom(pool, key); err != nil {
+			t.Fatalf("get %s after rerouting: %v", key, err)
+		}
+		return
+	}
+	t.Fatal("no key was picked to the dead peer")
+}
+
+// 删除最后一个节点之后哈希环是空的，开启rerouting时也不能panic
+func TestReroutingEmptyRing(t *testing.T) {
+	alive, _ := flakyServer(t, 0)
+	pool := geecache.NewHTTPPool("http://local", geecache.WithRerouting())
+	pool.Set(alive.URL)
+	pool.RemovePeer(alive.URL)
+	if peer, ok := pool.PickPeer("Tom"); ok || peer != nil {
+		t.Fatalf("PickPeer on an empty ring = %v, %v", peer, ok)
+	}
+}
@@ -0,0 +1,42 @@
+package geecache_test
+
+import (
+	"context"
+	"errors"
+	"mikucache/geecache"
+	"testing"
+	"time"
+)
+
+func TestGetContext(t *testing.T) {
+	release := make(chan struct{})
+	gee := geecache.NewGroup("ctx-scores", 2<<10, geecache.ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			select {
+			case <-release:
+				return []byte(db[key]), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		view, err := gee.GetContext(context.Background(), "Sam")
+		if err == nil && view.String() != db["Sam"] {
+			err = errors.New("unexpected value " + view.String())
+		}
+		done <- err
+	}()
+	if _, err := gee.GetContext(ctx, "Sam"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetContext err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// 一个调用方超时不会影响其他还在等待的调用方
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,36 @@
+package geecache_test
+
+import (
+	"fmt"
+	"mikucache/geecache"
+	"mikucache/geecache/eviction"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEvictionPolicy(t *testing.T) {
+	var hotLoads int32
+	// 每条记录 key 8字节 + value 8字节，最多放下40条
+	gee := geecache.NewGroup("eviction-scores", 40*16, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "hotkey00" {
+				atomic.AddInt32(&hotLoads, 1)
+			}
+			return []byte("01234567"), nil
+		},
+	), geecache.WithEvictionPolicy(eviction.NewLFU))
+
+	gee.Get("hotkey00")
+	gee.Get("hotkey00")
+	// 扫描远超缓存容量的冷数据，LFU不会淘汰访问过多次的热点key
+	for i := 0; i < 200; i++ {
+		gee.Get(fmt.Sprintf("scan%04d", i))
+	}
+	gee.Get("hotkey00")
+	if n := atomic.LoadInt32(&hotLoads); n != 1 {
+		t.Fatalf("hot key loaded %d times, want 1", n)
+	}
+	if s := gee.CacheStats(geecache.MainCache); s.Evictions == 0 || s.Bytes > 40*16 {
+		t.Fatalf("unexpected main cache stats %+v", s)
+	}
+}
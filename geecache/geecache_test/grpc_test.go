@@ -0,0 +1,156 @@
+package geecache_test
+
+import (
+	"context"
+	"fmt"
+	"mikucache/geecache"
+	"mikucache/geecache/geecachepb"
+	"net"
+	"testing"
+)
+
+// 启动一个只负责提供服务的节点，返回它的地址
+func startGRPCPeer(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := geecache.NewGRPCPool(lis.Addr().String())
+	go pool.Serve(lis)
+	t.Cleanup(pool.Close)
+	return lis.Addr().String()
+}
+
+func init() {
+	geecache.NewGroup("grpc-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("value-" + key), nil
+		},
+	))
+}
+
+func TestGRPCPool(t *testing.T) {
+	remote := startGRPCPeer(t)
+
+	local := geecache.NewGRPCPool("127.0.0.1:1")
+	defer local.Close()
+	local.Set("127.0.0.1:1", remote)
+
+	// 节点地址是随机端口，多试几个key总有落在远程节点上的
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprintf("key%d", i)
+		peer, ok := local.PickPeer(k)
+		if !ok {
+			continue
+		}
+		res := &geecachepb.Response{}
+		if err := peer.Get(&geecachepb.Request{Group: "grpc-scores", Key: k}, res); err != nil {
+			t.Fatalf("get %s from peer: %v", k, err)
+		}
+		if string(res.Value) != "value-"+k {
+			t.Fatalf("get %s from peer = %s, want value-%s", k, res.Value, k)
+		}
+		if err := peer.Get(&geecachepb.Request{Group: "no-such-group", Key: k}, res); err == nil {
+			t.Fatal("get from unknown group should fail")
+		}
+		return
+	}
+	t.Fatal("no key was picked to the remote peer")
+}
+
+func TestGRPCPoolAfterClose(t *testing.T) {
+	remote := startGRPCPeer(t)
+	// 超时时间为0表示不限制，和HTTPPool一致
+	local := geecache.NewGRPCPool("127.0.0.1:1", geecache.WithGRPCTimeout(0))
+	local.Set("127.0.0.1:1", remote)
+	local.Close()
+
+	// 关闭之后重新加入节点不会panic，也可以正常调用
+	local.AddPeer(remote)
+	defer local.Close()
+	peer, ok := local.PickPeer("Tom")
+	if !ok {
+		t.Fatal("PickPeer after AddPeer = false")
+	}
+	res := &geecachepb.Response{}
+	if err := peer.Get(&geecachepb.Request{Group: "grpc-scores", Key: "Tom"}, res); err != nil {
+		t.Fatalf("get with zero timeout: %v", err)
+	}
+	local.Close()
+	local.Set(remote)
+}
+
+// Close之后哈希环变化不会再触发后台转移，也不会panic
+func TestGRPCPoolCloseStopsRebalance(t *testing.T) {
+	pool := geecache.NewGRPCPool("127.0.0.1:1", geecache.WithGRPCRebalance(0, 0))
+	pool.Close()
+	pool.Close()
+	pool.Set("127.0.0.1:1", "127.0.0.1:2")
+	pool.Close()
+}
+
+func TestGRPCPoolShutdownAnnouncesLeave(t *testing.T) {
+	// 和HTTP节点一样，离开通知要能证明是节点自己发出的
+	secret := []byte("cluster-secret")
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := lis.Addr().String()
+	pool := geecache.NewGRPCPool(self, geecache.WithGRPCAuthenticator(geecache.NewHMACAuth(self, secret)))
+	served := make(chan error, 1)
+	go func() { served <- pool.Serve(lis) }()
+
+	otherLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherAddr := otherLis.Addr().String()
+	other := geecache.NewGRPCPool(otherAddr, geecache.WithGRPCAuthenticator(geecache.NewHMACAuth(otherAddr, secret)))
+	go other.Serve(otherLis)
+	defer other.Close()
+	other.Set(otherAddr, self)
+	pool.Set(self, otherAddr)
+
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("Serve after Shutdown = %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, ok := other.PickPeer(fmt.Sprintf("key%d", i)); ok {
+			t.Fatalf("key%d is still picked to the node that left", i)
+		}
+	}
+}
+
+func TestGRPCPoolShutdownDefaultConfig(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := lis.Addr().String()
+	pool := geecache.NewGRPCPool(self)
+	go pool.Serve(lis)
+
+	otherLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherAddr := otherLis.Addr().String()
+	other := geecache.NewGRPCPool(otherAddr)
+	go other.Serve(otherLis)
+	defer other.Close()
+	other.Set(otherAddr, self)
+	pool.Set(self, otherAddr)
+
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, ok := other.PickPeer(fmt.Sprintf("key%d", i)); ok {
+			t.Fatalf("key%d is still picked to the node that left", i)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package geecache_test
+
+import (
+	"mikucache/geecache"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHotCache(t *testing.T) {
+	gee := geecache.NewGroup("hot-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("key %s should be loaded from peer", key)
+			return nil, nil
+		},
+	))
+	peer := &fakePeer{}
+	gee.RegisterPeers(peer)
+
+	const n = 200
+	for i := 0; i < n; i++ {
+		view, err := gee.Get("Tom")
+		if err != nil || view.String() != "remote-Tom" {
+			t.Fatalf("get Tom = %s, %v", view, err)
+		}
+	}
+	// 热点key会被放进hotCache，后续请求不再访问远程节点
+	if gets := atomic.LoadInt32(&peer.gets); gets >= n {
+		t.Fatalf("peer gets = %d, hot key was never cached locally", gets)
+	}
+}
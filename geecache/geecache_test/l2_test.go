@@ -0,0 +1,135 @@
+package geecache_test
+
+import (
+	"fmt"
+	"mikucache/geecache"
+	"mikucache/geecache/diskcache"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newL2Group(t *testing.T, name string, loads *int32) (*geecache.Group, *diskcache.Store) {
+	t.Helper()
+	store, err := diskcache.Open(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	// 内存只能放下3条记录
+	return geecache.NewGroup(name, 9, snapshotGetter(loads), geecache.WithL2Cache(store)), store
+}
+
+// 被淘汰的值在后台写进L2，等它写完
+func waitL2(t *testing.T, store *diskcache.Store, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for store.Len() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("l2 has %d keys, want %d", store.Len(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestL2CacheServesEvicted(t *testing.T) {
+	var loads int32
+	gee, store := newL2Group(t, "l2-scores", &loads)
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		gee.Get(key)
+	}
+	// k1和k2被挤出内存，写进了L2
+	waitL2(t, store, 2)
+	atomic.StoreInt32(&loads, 0)
+	for _, key := range []string{"k1", "k2"} {
+		if view, err := gee.Get(key); err != nil || view.String() != "v" {
+			t.Fatalf("Get(%s) = %q, %v", key, view.String(), err)
+		}
+	}
+	if loads != 0 || gee.Stats.L2Hits.Get() != 2 {
+		t.Fatalf("loads = %d, l2 hits = %d", loads, gee.Stats.L2Hits.Get())
+	}
+}
+
+func TestL2CacheRemove(t *testing.T) {
+	var loads int32
+	gee, store := newL2Group(t, "l2-remove-scores", &loads)
+	for _, key := range []string{"k1", "k2", "k3", "k4"} {
+		gee.Get(key)
+	}
+	waitL2(t, store, 1)
+	if _, _, ok := store.Get("k1"); !ok {
+		t.Fatal("k1 should have been evicted to l2")
+	}
+	gee.Remove("k1")
+	if _, _, ok := store.Get("k1"); ok {
+		t.Fatal("Remove should delete the key from l2")
+	}
+	// Set的新值过期或被淘汰之前，L2中不能留着旧值
+	gee.Get("k2")
+	gee.Set("k2", []byte("w"))
+	if _, _, ok := store.Get("k2"); ok {
+		t.Fatal("Set should delete the old value from l2")
+	}
+}
+
+func TestL2CacheGetMulti(t *testing.T) {
+	var loads int32
+	gee, _ := newL2Group(t, "l2-multi-scores", &loads)
+	for _, key := range []string{"k1", "k2", "k3", "k4"} {
+		gee.Get(key)
+	}
+	atomic.StoreInt32(&loads, 0)
+	values, err := gee.GetMulti([]string{"k1"})
+	if err != nil || values["k1"].String() != "v" || loads != 0 {
+		t.Fatalf("GetMulti = %v, %v, loads = %d", values, err, loads)
+	}
+}
+
+// Put很慢的L2Cache
+type slowL2 struct {
+	release chan struct{}
+	puts    int32
+}
+
+func (s *slowL2) Get(key string) ([]byte, time.Time, bool) { return nil, time.Time{}, false }
+func (s *slowL2) Delete(key string) error                  { return nil }
+
+func (s *slowL2) Put(key string, value []byte, expire time.Time) error {
+	<-s.release
+	atomic.AddInt32(&s.puts, 1)
+	return nil
+}
+
+func TestL2CacheSlowPut(t *testing.T) {
+	var loads int32
+	l2 := &slowL2{release: make(chan struct{})}
+	gee := geecache.NewGroup("l2-slow-scores", 9, snapshotGetter(&loads), geecache.WithL2Cache(l2))
+	// 写L2阻塞时淘汰也不能阻塞Get，队列满了之后丢弃
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3000; i++ {
+			gee.Get(fmt.Sprintf("k%d", i))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get blocked on a slow l2 cache")
+	}
+	if gee.Stats.L2Drops.Get() == 0 {
+		t.Fatal("evicted values should be dropped when the queue is full")
+	}
+	// 还在队列中的值也能读到，只有正在写入的那一个读不到
+	atomic.StoreInt32(&loads, 0)
+	for i := 0; i < 100; i++ {
+		if view, err := gee.Get(fmt.Sprintf("k%d", i)); err != nil || view.String() != "v" {
+			t.Fatalf("Get(k%d) = %q, %v", i, view.String(), err)
+		}
+	}
+	if loads > 1 {
+		t.Fatalf("loads = %d, queued values should be served", loads)
+	}
+	close(l2.release)
+}
@@ -0,0 +1,111 @@
+package geecache_test
+
+import (
+	"fmt"
+	"mikucache/geecache"
+	"testing"
+)
+
+func TestHTTPPoolAddRemovePeer(t *testing.T) {
+	pool := geecache.NewHTTPPool("http://node1")
+	pool.AddPeer("http://node1", "http://node2")
+
+	owners := make(map[string]geecache.PeerGetter)
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprintf("key%d", i)
+		if peer, ok := pool.PickPeer(k); ok {
+			owners[k] = peer
+		}
+	}
+	if len(owners) == 0 {
+		t.Fatal("no key was picked to node2")
+	}
+
+	// 新增节点之后，仍然留在node2上的key复用原来的客户端
+	pool.AddPeer("http://node3")
+	moved := 0
+	for k, before := range owners {
+		after, ok := pool.PickPeer(k)
+		if ok && after == before {
+			continue
+		}
+		moved++
+	}
+	if moved == len(owners) {
+		t.Fatal("every key moved away from node2 after adding node3")
+	}
+
+	pool.RemovePeer("http://node2", "http://node3")
+	for i := 0; i < 100; i++ {
+		if _, ok := pool.PickPeer(fmt.Sprintf("key%d", i)); ok {
+			t.Fatal("only node1 is left, no key should be picked to a remote peer")
+		}
+	}
+}
+
+// 由node2负责的key的数量
+func remoteKeys(pool *geecache.HTTPPool) int {
+	n := 0
+	for i := 0; i < 1000; i++ {
+		if _, ok := pool.PickPeer(fmt.Sprintf("key%d", i)); ok {
+			n++
+		}
+	}
+	return n
+}
+
+func TestHTTPPoolWeightedPeers(t *testing.T) {
+	pool := geecache.NewHTTPPool("http://node1")
+	pool.Set("http://node1", "http://node2 4")
+	heavy := remoteKeys(pool)
+	if heavy < 600 {
+		t.Fatalf("node2 with weight 4 owns %d of 1000 keys", heavy)
+	}
+
+	// 节点列表中修改了权重：新的AddPeer先到，旧的RemovePeer后到
+	pool.AddPeer("http://node2 1")
+	pool.RemovePeer("http://node2 4")
+	light := remoteKeys(pool)
+	if light == 0 || light >= heavy {
+		t.Fatalf("node2 owns %d keys after lowering its weight, %d before", light, heavy)
+	}
+	pool.RemovePeer("http://node2")
+	if n := remoteKeys(pool); n != 0 {
+		t.Fatalf("node2 owns %d keys after removal", n)
+	}
+
+	// 不带权重时只按地址删除，不管节点的权重是多少
+	pool.AddPeer("http://node2 3")
+	pool.RemovePeer("http://node2")
+	if n := remoteKeys(pool); n != 0 {
+		t.Fatalf("node2 with weight 3 owns %d keys after removal by address", n)
+	}
+
+	// 格式错误的节点被跳过
+	pool.Set("http://node1", "http://node2 heavy")
+	if n := remoteKeys(pool); n != 0 {
+		t.Fatalf("invalid spec was added, node2 owns %d keys", n)
+	}
+}
+
+func TestParsePeerSpec(t *testing.T) {
+	cases := []struct {
+		spec   string
+		addr   string
+		weight int
+		ok     bool
+	}{
+		{"http://node1", "http://node1", 1, true},
+		{"  http://node1 \t3 ", "http://node1", 3, true},
+		{"http://node1 0", "", 0, false},
+		{"http://node1 x", "", 0, false},
+		{"http://node1 2 3", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, c := range cases {
+		addr, weight, err := geecache.ParsePeerSpec(c.spec)
+		if addr != c.addr || weight != c.weight || (err == nil) != c.ok {
+			t.Errorf("ParsePeerSpec(%q) = %q, %d, %v", c.spec, addr, weight, err)
+		}
+	}
+}
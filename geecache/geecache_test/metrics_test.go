@@ -0,0 +1,44 @@
+package geecache_test
+
+import (
+	"io"
+	"mikucache/geecache"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	gee := geecache.NewGroup("metrics-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		},
+	))
+	gee.Get("Tom")
+	gee.Get("Tom")
+
+	pool := geecache.NewHTTPPool("http://local")
+	pool.Set("http://local", "http://remote")
+	srv := httptest.NewServer(geecache.NewMetricsHandler(pool))
+	defer srv.Close()
+	res, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+
+	for _, want := range []string{
+		`# TYPE geecache_gets_total counter`,
+		`geecache_gets_total{group="metrics-scores"} 2`,
+		`geecache_hits_total{group="metrics-scores"} 1`,
+		`geecache_cache_items{group="metrics-scores",cache="main"} 1`,
+		`geecache_local_load_duration_seconds_count{group="metrics-scores"} 1`,
+		`geecache_local_load_duration_seconds_bucket{group="metrics-scores",le="+Inf"} 1`,
+		`geecache_peer_client_requests_total{peer="http://remote"} 0`,
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
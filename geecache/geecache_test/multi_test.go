@@ -0,0 +1,186 @@
+package geecache_test
+
+import (
+	"context"
+	"mikucache/geecache"
+	"mikucache/geecache/geecachepb"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录每次批量加载的key
+type batchDB struct {
+	mu    sync.Mutex
+	calls [][]string
+}
+
+func (b *batchDB) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	b.calls = append(b.calls, sorted)
+	values := make(map[string][]byte)
+	for _, key := range keys {
+		if v, ok := db[key]; ok {
+			values[key] = []byte(v)
+		}
+	}
+	return values, nil
+}
+
+func viewStrings(views map[string]geecache.ByteView) map[string]string {
+	m := make(map[string]string, len(views))
+	for k, v := range views {
+		m[k] = v.String()
+	}
+	return m
+}
+
+func TestGetMultiBatchGetter(t *testing.T) {
+	src := &batchDB{}
+	gee := geecache.NewGroup("multi-scores", 2<<10, geecache.BatchGetterFunc(src.GetMulti),
+		geecache.WithNegativeTTL(time.Minute))
+	gee.Get("Sam")
+
+	want := map[string]string{"Tom": db["Tom"], "Jack": db["Jack"], "Sam": db["Sam"]}
+	for i := 0; i < 2; i++ {
+		views, err := gee.GetMulti([]string{"Tom", "Jack", "Sam", "unknown", "Tom"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := viewStrings(views); !reflect.DeepEqual(got, want) {
+			t.Fatalf("GetMulti = %v, want %v", got, want)
+		}
+	}
+	// Sam已经在缓存中；第二次全部命中缓存，不存在的key被负缓存
+	wantCalls := [][]string{{"Sam"}, {"Jack", "Tom", "unknown"}}
+	if !reflect.DeepEqual(src.calls, wantCalls) {
+		t.Fatalf("batch calls = %v, want %v", src.calls, wantCalls)
+	}
+	// 不存在的key不算加载失败
+	if n := gee.Stats.LocalLoadErrs.Get(); n != 0 {
+		t.Fatalf("local load errors = %d, want 0", n)
+	}
+}
+
+func TestGetMultiSharesLoads(t *testing.T) {
+	src := &batchDB{}
+	loading, release := make(chan struct{}), make(chan struct{})
+	gee := geecache.NewGroup("multi-shared-scores", 2<<10, geecache.BatchGetterFunc(
+		func(ctx context.Context, keys []string) (map[string][]byte, error) {
+			if keys[0] == "Tom" {
+				close(loading)
+				<-release
+			}
+			return src.GetMulti(ctx, keys)
+		},
+	))
+	// Get正在加载Tom
+	got := make(chan string, 1)
+	go func() {
+		view, _ := gee.Get("Tom")
+		got <- view.String()
+	}()
+	<-loading
+
+	done := make(chan map[string]geecache.ByteView, 1)
+	go func() {
+		views, _ := gee.GetMulti([]string{"Tom", "Jack"})
+		done <- views
+	}()
+	// Jack的批量加载不用等Tom，Tom等待Get的那次加载
+	deadline := time.Now().Add(time.Second)
+	for {
+		src.mu.Lock()
+		n := len(src.calls)
+		src.mu.Unlock()
+		if n == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	views := <-done
+	if <-got != db["Tom"] || views["Tom"].String() != db["Tom"] || views["Jack"].String() != db["Jack"] {
+		t.Fatalf("GetMulti = %v", viewStrings(views))
+	}
+	wantCalls := [][]string{{"Jack"}, {"Tom"}}
+	if !reflect.DeepEqual(src.calls, wantCalls) {
+		t.Fatalf("batch calls = %v, want %v", src.calls, wantCalls)
+	}
+}
+
+func TestGetMultiFromPeer(t *testing.T) {
+	gee := geecache.NewGroup("multi-peer-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("key %s should be loaded from peer", key)
+			return nil, nil
+		},
+	))
+	peer := &fakePeer{}
+	gee.RegisterPeers(peer)
+	views, err := gee.GetMulti([]string{"Tom", "Jack", "Sam"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"Tom": "remote-Tom", "Jack": "remote-Jack", "Sam": "remote-Sam"}
+	if got := viewStrings(views); !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetMulti = %v, want %v", got, want)
+	}
+	// 同一个节点负责的key只发一次请求
+	if peer.multiGets != 1 || peer.gets != 0 {
+		t.Fatalf("multi gets = %d, gets = %d", peer.multiGets, peer.gets)
+	}
+}
+
+func checkMultiResponse(t *testing.T, res *geecachepb.GetMultiResponse) {
+	t.Helper()
+	if len(res.GetValues()) != 3 {
+		t.Fatalf("got %d values, want 3", len(res.GetValues()))
+	}
+	if string(res.Values[0].GetValue()) != db["Tom"] || !res.Values[1].GetNotFound() || res.Errors[2] == "" {
+		t.Fatalf("unexpected response %v", res)
+	}
+}
+
+func TestHTTPPoolGetMulti(t *testing.T) {
+	geecache.NewGroup("http-multi-scores", 2<<10, notFoundGetter(new(int32)))
+	srv := httptest.NewServer(geecache.NewHTTPPool("http://server"))
+	defer srv.Close()
+
+	local := geecache.NewHTTPPool("http://local")
+	local.Set(srv.URL)
+	peer, ok := local.PickPeer("Tom")
+	if !ok {
+		t.Fatal("all keys should be picked to the remote peer")
+	}
+	res := &geecachepb.GetMultiResponse{}
+	in := &geecachepb.GetMultiRequest{Group: "http-multi-scores", Keys: []string{"Tom", "unknown", ""}}
+	if err := peer.GetMulti(context.Background(), in, res); err != nil {
+		t.Fatal(err)
+	}
+	checkMultiResponse(t, res)
+}
+
+func TestGRPCGetMulti(t *testing.T) {
+	geecache.NewGroup("grpc-multi-scores", 2<<10, notFoundGetter(new(int32)))
+	remote := startGRPCPeer(t)
+	local := geecache.NewGRPCPool("127.0.0.1:1")
+	defer local.Close()
+	local.Set(remote)
+	peer, ok := local.PickPeer("Tom")
+	if !ok {
+		t.Fatal("all keys should be picked to the remote peer")
+	}
+	res := &geecachepb.GetMultiResponse{}
+	in := &geecachepb.GetMultiRequest{Group: "grpc-multi-scores", Keys: []string{"Tom", "unknown", ""}}
+	if err := peer.GetMulti(context.Background(), in, res); err != nil {
+		t.Fatal(err)
+	}
+	checkMultiResponse(t, res)
+}
@@ -0,0 +1,122 @@
+package geecache_test
+
+import (
+	"errors"
+	"fmt"
+	"mikucache/geecache"
+	"mikucache/geecache/geecachepb"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 返回一个只认识db中的key的Getter，loads统计调用次数
+func notFoundGetter(loads *int32) geecache.Getter {
+	return geecache.GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(loads, 1)
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist: %w", key, geecache.ErrNotFound)
+	})
+}
+
+func TestNegativeCache(t *testing.T) {
+	var loads int32
+	gee := geecache.NewGroup("negative-scores", 2<<10, notFoundGetter(&loads),
+		geecache.WithNegativeTTL(50*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		if _, err := gee.Get("unknown"); !errors.Is(err, geecache.ErrNotFound) {
+			t.Fatalf("get unknown err = %v, want ErrNotFound", err)
+		}
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Fatalf("loads = %d, want 1 with negative caching", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	gee.Get("unknown")
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("loads = %d, want 2 after negative ttl", n)
+	}
+
+	// 写入之后负缓存被覆盖
+	if err := gee.Set("unknown", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := gee.Get("unknown"); err != nil || view.String() != "1" {
+		t.Fatalf("get unknown after set = %s, %v", view, err)
+	}
+}
+
+func TestNegativeCacheDisabled(t *testing.T) {
+	var loads int32
+	gee := geecache.NewGroup("no-negative-scores", 2<<10, notFoundGetter(&loads))
+	gee.Get("unknown")
+	gee.Get("unknown")
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("loads = %d, want 2 without negative caching", n)
+	}
+}
+
+func TestNotFoundFromPeer(t *testing.T) {
+	var loads int32
+	geecache.NewGroup("http-negative-scores", 2<<10, notFoundGetter(&loads),
+		geecache.WithNegativeTTL(time.Minute))
+	srv := httptest.NewServer(geecache.NewHTTPPool("http://server"))
+	defer srv.Close()
+
+	local := geecache.NewHTTPPool("http://local")
+	local.Set("http://local", srv.URL)
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprintf("missing%d", i)
+		peer, ok := local.PickPeer(k)
+		if !ok {
+			continue
+		}
+		for j := 0; j < 2; j++ {
+			res := &geecachepb.Response{}
+			if err := peer.Get(&geecachepb.Request{Group: "http-negative-scores", Key: k}, res); err != nil {
+				t.Fatalf("get %s from peer: %v", k, err)
+			}
+			if !res.GetNotFound() {
+				t.Fatalf("response for %s should be not found", k)
+			}
+		}
+		if n := atomic.LoadInt32(&loads); n != 1 {
+			t.Fatalf("loads = %d, want 1", n)
+		}
+		// group不存在也是404，但不是Response，应该返回错误
+		if err := peer.Get(&geecachepb.Request{Group: "no-such-group", Key: k}, &geecachepb.Response{}); err == nil {
+			t.Fatal("get from unknown group should fail")
+		}
+		return
+	}
+	t.Fatal("no key was picked to the remote peer")
+}
+
+func TestGRPCNotFound(t *testing.T) {
+	var loads int32
+	geecache.NewGroup("grpc-negative-scores", 2<<10, notFoundGetter(&loads))
+	remote := startGRPCPeer(t)
+	local := geecache.NewGRPCPool("127.0.0.1:1")
+	defer local.Close()
+	local.Set("127.0.0.1:1", remote)
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprintf("missing%d", i)
+		peer, ok := local.PickPeer(k)
+		if !ok {
+			continue
+		}
+		res := &geecachepb.Response{}
+		if err := peer.Get(&geecachepb.Request{Group: "grpc-negative-scores", Key: k}, res); err != nil {
+			t.Fatalf("get %s from peer: %v", k, err)
+		}
+		if !res.GetNotFound() {
+			t.Fatalf("response for %s should be not found", k)
+		}
+		return
+	}
+	t.Fatal("no key was picked to the remote peer")
+}
@@ -0,0 +1,74 @@
+package geecache_test
+
+import (
+	"context"
+	"mikucache/geecache"
+	"mikucache/geecache/geecachepb"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 假的远程节点，所有key都由它负责
+type fakePeer struct {
+	gets      int32
+	multiGets int32
+	mu        sync.Mutex
+	deletes   []*geecachepb.DeleteRequest
+	sets      []*geecachepb.SetRequest
+}
+
+func (p *fakePeer) PickPeer(key string) (geecache.PeerGetter, bool) {
+	return p, true
+}
+
+func (p *fakePeer) AllPeers() []geecache.PeerGetter {
+	return []geecache.PeerGetter{p}
+}
+
+func (p *fakePeer) Get(in *geecachepb.Request, out *geecachepb.Response) error {
+	return p.GetContext(context.Background(), in, out)
+}
+
+func (p *fakePeer) GetContext(ctx context.Context, in *geecachepb.Request, out *geecachepb.Response) error {
+	atomic.AddInt32(&p.gets, 1)
+	out.Value = []byte("remote-" + in.GetKey())
+	return nil
+}
+
+func (p *fakePeer) Delete(ctx context.Context, in *geecachepb.DeleteRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deletes = append(p.deletes, in)
+	return nil
+}
+
+func (p *fakePeer) Set(ctx context.Context, in *geecachepb.SetRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sets = append(p.sets, in)
+	return nil
+}
+
+// 副本是在后台推送的，等到收到n个写入请求，最多等1秒
+func (p *fakePeer) waitSets(n int) []*geecachepb.SetRequest {
+	deadline := time.Now().Add(time.Second)
+	for {
+		p.mu.Lock()
+		sets := slices.Clone(p.sets)
+		p.mu.Unlock()
+		if len(sets) >= n || time.Now().After(deadline) {
+			return sets
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (p *fakePeer) GetMulti(ctx context.Context, in *geecachepb.GetMultiRequest, out *geecachepb.GetMultiResponse) error {
+	atomic.AddInt32(&p.multiGets, 1)
+	for _, key := range in.GetKeys() {
+		out.Values = append(out.Values, &geecachepb.Response{Value: []byte("remote-" + key)})
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package geecache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mikucache/geecache"
+	"mikucache/geecache/geecachepb"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 自己一开始负责所有key，加载keys之后加入rec负责的节点
+func rebalanceCluster(t *testing.T, name string, loads *int32, keys []string, opts ...geecache.HTTPPoolOption) (*geecache.HTTPPool, *geecache.Group, *recordingPeer) {
+	t.Helper()
+	rec := &recordingPeer{}
+	recSrv := httptest.NewServer(rec)
+	t.Cleanup(recSrv.Close)
+	pool := geecache.NewHTTPPool("http://self", opts...)
+	pool.Set("http://self")
+	gee := geecache.NewGroup(name, 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(loads, 1)
+			return []byte("value-" + key), nil
+		},
+	))
+	gee.RegisterPeers(pool)
+	for _, key := range keys {
+		gee.Get(key)
+	}
+	pool.Set("http://self", recSrv.URL)
+	return pool, gee, rec
+}
+
+func rebalanceKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	return keys
+}
+
+func TestRebalance(t *testing.T) {
+	var loads int32
+	keys := rebalanceKeys(20)
+	pool, gee, rec := rebalanceCluster(t, "rebalance-scores", &loads, keys, geecache.WithRebalance(0, 0))
+	var moved, kept []string
+	for _, key := range keys {
+		if _, ok := pool.PickPeer(key); ok {
+			moved = append(moved, key)
+		} else {
+			kept = append(kept, key)
+		}
+	}
+	if len(moved) == 0 || len(kept) == 0 {
+		t.Fatalf("moved %d keys, kept %d keys, want both", len(moved), len(kept))
+	}
+
+	if err := pool.Rebalance(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	rec.mu.Lock()
+	var got []string
+	for _, in := range rec.sets {
+		if string(in.GetValue()) != "value-"+in.GetKey() {
+			t.Fatalf("transferred %s = %q", in.GetKey(), in.GetValue())
+		}
+		got = append(got, in.GetKey())
+	}
+	rec.mu.Unlock()
+	if len(got) != len(moved) {
+		t.Fatalf("transferred %v, want %v", got, moved)
+	}
+	if n := gee.Stats.KeysHandedOff.Get(); n != int64(len(moved)) {
+		t.Fatalf("KeysHandedOff = %d, want %d", n, len(moved))
+	}
+
+	// 自己还负责的key留在缓存中，转移走的已经删除了
+	atomic.StoreInt32(&loads, 0)
+	for _, key := range kept {
+		gee.Get(key)
+	}
+	if loads != 0 {
+		t.Fatalf("%d kept keys were loaded again", loads)
+	}
+	// rec的Get会失败，然后从本地加载
+	gee.Get(moved[0])
+	if loads != 1 {
+		t.Fatalf("moved key %s should have been removed from the cache", moved[0])
+	}
+}
+
+func TestRebalanceTopN(t *testing.T) {
+	var loads int32
+	// 新节点分到的key要多于3个，和它的端口有关，key多一些才稳定
+	keys := rebalanceKeys(40)
+	pool, _, rec := rebalanceCluster(t, "rebalance-topn-scores", &loads, keys, geecache.WithRebalance(3, 0))
+	var moved []string
+	for _, key := range keys {
+		if _, ok := pool.PickPeer(key); ok {
+			moved = append(moved, key)
+		}
+	}
+	if err := pool.Rebalance(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	// 只转移最近访问的3个，从新到旧
+	if len(rec.sets) != 3 {
+		t.Fatalf("transferred %d keys, want 3", len(rec.sets))
+	}
+	for i, in := range rec.sets {
+		if want := moved[len(moved)-1-i]; in.GetKey() != want {
+			t.Fatalf("transfer %d = %s, want %s", i, in.GetKey(), want)
+		}
+	}
+}
+
+func TestRebalanceBandwidth(t *testing.T) {
+	var loads int32
+	keys := rebalanceKeys(20)
+	// 每条记录大约15字节，限速1000字节每秒
+	pool, _, rec := rebalanceCluster(t, "rebalance-bandwidth-scores", &loads, keys, geecache.WithRebalance(0, 1000))
+	start := time.Now()
+	if err := pool.Rebalance(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	rec.mu.Lock()
+	bytes := 0
+	for _, in := range rec.sets {
+		bytes += len(in.GetKey()) + len(in.GetValue())
+	}
+	rec.mu.Unlock()
+	if want := time.Duration(bytes) * time.Second / 1000; time.Since(start) < want*9/10 {
+		t.Fatalf("transferred %d bytes in %v, want at least %v", bytes, time.Since(start), want)
+	}
+
+	// ctx结束时停止转移
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	pool.Set("http://self")
+	pool.Set("http://self", "http://127.0.0.1:1")
+	if err := pool.Rebalance(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Rebalance = %v, want deadline exceeded", err)
+	}
+}
+
+func TestRebalanceOnMembershipChange(t *testing.T) {
+	var loads int32
+	_, _, rec := rebalanceCluster(t, "rebalance-auto-scores", &loads, rebalanceKeys(20), geecache.WithRebalance(0, 0))
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		rec.mu.Lock()
+		n := len(rec.sets)
+		rec.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("keys were not transferred after the membership change")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// 关闭之后不再在后台转移，哈希环变化也不会panic
+func TestRebalanceStopsOnShutdown(t *testing.T) {
+	var loads int32
+	pool, _, rec := rebalanceCluster(t, "rebalance-shutdown-scores", &loads, rebalanceKeys(20), geecache.WithRebalance(0, 0))
+	if err := geecache.NewServer(pool).Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 加入rec时触发的转移还在等待，Shutdown之后不能再发给rec
+	time.Sleep(1500 * time.Millisecond)
+	rec.mu.Lock()
+	n := len(rec.sets)
+	rec.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("transferred %d keys after Shutdown", n)
+	}
+	pool.Set("http://self", "http://127.0.0.1:1")
+}
+
+func TestTransfer(t *testing.T) {
+	var loads int32
+	gee := geecache.NewGroup("transfer-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return []byte(db[key]), nil
+		},
+	))
+	in := &geecachepb.TransferRequest{
+		Group: "transfer-scores",
+		Entries: []*geecachepb.SetRequest{
+			{Key: "Tom", Value: []byte("moved-Tom")},
+			{Key: "Jack", Value: []byte("moved-Jack"), Expire: time.Now().Add(time.Hour).UnixNano()},
+		},
+	}
+	srv := httptest.NewServer(geecache.NewHTTPPool("http://server"))
+	defer srv.Close()
+	httpPool := geecache.NewHTTPPool("http://local")
+	httpPool.Set(srv.URL)
+	grpcPool := geecache.NewGRPCPool("127.0.0.1:1")
+	defer grpcPool.Close()
+	grpcPool.Set(startGRPCPeer(t))
+
+	for name, picker := range map[string]geecache.PeerPicker{"http": httpPool, "grpc": grpcPool} {
+		gee.Remove("Tom")
+		gee.Remove("Jack")
+		peer, _ := picker.PickPeer("Tom")
+		if err := peer.(geecache.Transferrer).Transfer(context.Background(), in); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, key := range []string{"Tom", "Jack"} {
+			if view, err := gee.Get(key); err != nil || view.String() != "moved-"+key {
+				t.Fatalf("%s: Get(%s) = %q, %v", name, key, view.String(), err)
+			}
+		}
+		if view, _ := gee.Get("Jack"); view.Expire().IsZero() {
+			t.Fatalf("%s: expire of Jack was not transferred", name)
+		}
+	}
+	if loads != 0 {
+		t.Fatalf("loads = %d, want 0", loads)
+	}
+}
@@ -0,0 +1,80 @@
+package geecache_test
+
+import (
+	"context"
+	"fmt"
+	"mikucache/geecache"
+	"mikucache/geecache/geecachepb"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRemove(t *testing.T) {
+	var loads int32
+	gee := geecache.NewGroup("remove-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return []byte(db[key]), nil
+		},
+	))
+	gee.Get("Tom")
+	gee.Get("Tom")
+	if err := gee.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	gee.Get("Tom")
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("loads = %d, want 2 after remove", n)
+	}
+}
+
+func TestRemoveBroadcast(t *testing.T) {
+	gee := geecache.NewGroup("broadcast-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		},
+	), geecache.WithBroadcastInvalidation())
+	peer := &fakePeer{}
+	gee.RegisterPeers(peer)
+	if err := gee.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	// key由远程节点负责，要求它删除之后再广播给其他节点
+	if len(peer.deletes) != 1 || !peer.deletes[0].GetBroadcast() || peer.deletes[0].GetKey() != "Tom" {
+		t.Fatalf("unexpected delete requests %v", peer.deletes)
+	}
+}
+
+func TestHTTPPoolDelete(t *testing.T) {
+	var loads int32
+	gee := geecache.NewGroup("http-remove-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return []byte("value-" + key), nil
+		},
+	))
+	srv := httptest.NewServer(geecache.NewHTTPPool("http://server"))
+	defer srv.Close()
+
+	local := geecache.NewHTTPPool("http://local")
+	local.Set("http://local", srv.URL)
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprintf("key%d", i)
+		peer, ok := local.PickPeer(k)
+		if !ok {
+			continue
+		}
+		gee.Get(k)
+		err := peer.Delete(context.Background(), &geecachepb.DeleteRequest{Group: "http-remove-scores", Key: k})
+		if err != nil {
+			t.Fatal(err)
+		}
+		gee.Get(k)
+		if n := atomic.LoadInt32(&loads); n != 2 {
+			t.Fatalf("loads = %d, want 2 after delete", n)
+		}
+		return
+	}
+	t.Fatal("no key was picked to the remote peer")
+}
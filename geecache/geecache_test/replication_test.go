@@ -0,0 +1,233 @@
+package geecache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mikucache/geecache"
+	"mikucache/geecache/geecachepb"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// 每个key都由owners负责，nil表示自己
+type replicaPicker struct {
+	owners []geecache.PeerGetter
+}
+
+func (p *replicaPicker) PickPeer(key string) (geecache.PeerGetter, bool) {
+	return p.owners[0], p.owners[0] != nil
+}
+
+func (p *replicaPicker) PickReplicas(key string) []geecache.PeerGetter {
+	return p.owners
+}
+
+// 已经挂掉的远程节点
+type deadPeer struct {
+	fakePeer
+}
+
+func (p *deadPeer) GetContext(ctx context.Context, in *geecachepb.Request, out *geecachepb.Response) error {
+	atomic.AddInt32(&p.gets, 1)
+	return errors.New("connection refused")
+}
+
+func (p *deadPeer) Set(ctx context.Context, in *geecachepb.SetRequest) error {
+	return errors.New("connection refused")
+}
+
+func (p *deadPeer) GetMulti(ctx context.Context, in *geecachepb.GetMultiRequest, out *geecachepb.GetMultiResponse) error {
+	atomic.AddInt32(&p.multiGets, 1)
+	return errors.New("connection refused")
+}
+
+func newReplicaGroup(name string, loads *int32) *geecache.Group {
+	return geecache.NewGroup(name, 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(loads, 1)
+			return []byte(db[key]), nil
+		},
+	))
+}
+
+func TestReplicaReadFailover(t *testing.T) {
+	var loads int32
+	gee := newReplicaGroup("replica-failover-scores", &loads)
+	dead, alive := &deadPeer{}, &fakePeer{}
+	gee.RegisterPeers(&replicaPicker{owners: []geecache.PeerGetter{dead, alive}})
+
+	view, err := gee.Get("Tom")
+	if err != nil || view.String() != "remote-Tom" {
+		t.Fatalf("Get(Tom) = %q, %v", view.String(), err)
+	}
+	if dead.gets != 1 || alive.gets != 1 || loads != 0 {
+		t.Fatalf("dead gets = %d, alive gets = %d, loads = %d", dead.gets, alive.gets, loads)
+	}
+}
+
+func TestReplicaGetMultiFailover(t *testing.T) {
+	var loads int32
+	gee := newReplicaGroup("replica-multi-failover-scores", &loads)
+	dead, alive := &deadPeer{}, &fakePeer{}
+	gee.RegisterPeers(&replicaPicker{owners: []geecache.PeerGetter{dead, alive}})
+
+	views, err := gee.GetMulti([]string{"Tom", "Jack"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if views["Tom"].String() != "remote-Tom" || views["Jack"].String() != "remote-Jack" {
+		t.Fatalf("GetMulti = %v", views)
+	}
+	// 批量请求发给主节点，它挂了之后和Get一样改为请求下一个副本节点，不从数据源加载
+	if dead.multiGets != 1 || alive.gets != 2 || loads != 0 {
+		t.Fatalf("dead multi gets = %d, alive gets = %d, loads = %d", dead.multiGets, alive.gets, loads)
+	}
+}
+
+func TestReplicaPushAfterLoad(t *testing.T) {
+	var loads int32
+	gee := newReplicaGroup("replica-push-scores", &loads)
+	p1, p2 := &fakePeer{}, &fakePeer{}
+	gee.RegisterPeers(&replicaPicker{owners: []geecache.PeerGetter{nil, p1, p2}})
+
+	if view, err := gee.Get("Tom"); err != nil || view.String() != db["Tom"] {
+		t.Fatalf("Get(Tom) = %q, %v", view.String(), err)
+	}
+	// 自己是主节点，从数据源加载之后推送给另外两个副本节点
+	for i, p := range []*fakePeer{p1, p2} {
+		if p.gets != 0 {
+			t.Fatalf("replica %d should not be asked, gets = %d", i, p.gets)
+		}
+		if sets := p.waitSets(1); len(sets) != 1 || !sets[0].GetReplica() || string(sets[0].GetValue()) != db["Tom"] {
+			t.Fatalf("replica %d got sets %v", i, sets)
+		}
+	}
+}
+
+func TestReplicaPrimaryDown(t *testing.T) {
+	var loads int32
+	gee := newReplicaGroup("replica-primary-down-scores", &loads)
+	dead, p2 := &deadPeer{}, &fakePeer{}
+	gee.RegisterPeers(&replicaPicker{owners: []geecache.PeerGetter{dead, nil, p2}})
+
+	// 主节点挂了，自己是第二个副本节点，从数据源加载
+	if view, err := gee.Get("Tom"); err != nil || view.String() != db["Tom"] {
+		t.Fatalf("Get(Tom) = %q, %v", view.String(), err)
+	}
+	if dead.gets != 1 || loads != 1 {
+		t.Fatalf("dead gets = %d, loads = %d", dead.gets, loads)
+	}
+	if sets := p2.waitSets(1); len(sets) != 1 || !sets[0].GetReplica() {
+		t.Fatalf("replica got sets %v", sets)
+	}
+	// 值在mainCache中，不会再去请求主节点
+	gee.Get("Tom")
+	if dead.gets != 1 || loads != 1 {
+		t.Fatalf("dead gets = %d, loads = %d after second get", dead.gets, loads)
+	}
+}
+
+// 挂住的副本节点不能拖慢主节点的加载
+type slowPeer struct {
+	fakePeer
+	release chan struct{}
+}
+
+func (p *slowPeer) Set(ctx context.Context, in *geecachepb.SetRequest) error {
+	<-p.release
+	return p.fakePeer.Set(ctx, in)
+}
+
+func TestReplicaPushDoesNotBlockLoad(t *testing.T) {
+	var loads int32
+	gee := newReplicaGroup("replica-slow-push-scores", &loads)
+	slow := &slowPeer{release: make(chan struct{})}
+	gee.RegisterPeers(&replicaPicker{owners: []geecache.PeerGetter{nil, slow}})
+
+	if view, err := gee.Get("Tom"); err != nil || view.String() != db["Tom"] {
+		t.Fatalf("Get(Tom) = %q, %v", view.String(), err)
+	}
+	close(slow.release)
+	if sets := slow.waitSets(1); len(sets) != 1 {
+		t.Fatalf("replica got sets %v", sets)
+	}
+}
+
+func TestReplicaRemove(t *testing.T) {
+	var loads int32
+	gee := newReplicaGroup("replica-remove-scores", &loads)
+	p1, p2 := &fakePeer{}, &fakePeer{}
+	gee.RegisterPeers(&replicaPicker{owners: []geecache.PeerGetter{p1, nil, p2}})
+
+	if err := gee.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range []*fakePeer{p1, p2} {
+		if len(p.deletes) != 1 || p.deletes[0].GetKey() != "Tom" || p.deletes[0].GetBroadcast() {
+			t.Fatalf("replica %d got deletes %v", i, p.deletes)
+		}
+	}
+}
+
+func TestReplicaSetSkipsWriteThrough(t *testing.T) {
+	var writes, loads int32
+	gee := geecache.NewGroup("replica-set-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return []byte(db[key]), nil
+		},
+	), geecache.WithSetter(geecache.SetterFunc(func(key string, value []byte) error {
+		atomic.AddInt32(&writes, 1)
+		return nil
+	})))
+	srv := httptest.NewServer(geecache.NewHTTPPool("http://server"))
+	defer srv.Close()
+
+	local := geecache.NewHTTPPool("http://local")
+	local.Set(srv.URL)
+	peer, _ := local.PickPeer("Tom")
+	err := peer.Set(context.Background(), &geecachepb.SetRequest{
+		Group:   "replica-set-scores",
+		Key:     "Tom",
+		Value:   []byte("pushed"),
+		Replica: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 副本只放进缓存，不写数据源
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "pushed" {
+		t.Fatalf("Get(Tom) = %q, %v", view.String(), err)
+	}
+	if writes != 0 || loads != 0 {
+		t.Fatalf("writes = %d, loads = %d, want 0", writes, loads)
+	}
+}
+
+func TestHTTPPoolPickReplicas(t *testing.T) {
+	nodes := []string{"http://a", "http://b", "http://c"}
+	pool := geecache.NewHTTPPool("http://b", geecache.WithReplication(2))
+	pool.Set(nodes...)
+	owned := 0
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		owners := pool.PickReplicas(key)
+		if len(owners) != 2 || owners[0] == owners[1] {
+			t.Fatalf("PickReplicas(%s) = %v", key, owners)
+		}
+		// 第一个就是PickPeer选中的节点
+		peer, ok := pool.PickPeer(key)
+		if ok != (owners[0] != nil) || (ok && peer != owners[0]) {
+			t.Fatalf("PickReplicas(%s)[0] = %v, PickPeer = %v, %v", key, owners[0], peer, ok)
+		}
+		if owners[0] == nil || owners[1] == nil {
+			owned++
+		}
+	}
+	// 3个节点2个副本，自己负责大约2/3的key
+	if owned < 40 || owned > 90 {
+		t.Fatalf("self owns %d of 100 keys", owned)
+	}
+}
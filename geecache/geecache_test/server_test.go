@@ -0,0 +1,250 @@
+package geecache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mikucache/geecache"
+	"mikucache/geecache/geecachepb"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 在随机端口上启动Server，返回它的地址
+func startServer(t *testing.T, opts ...geecache.ServerOption) (*geecache.Server, *geecache.HTTPPool, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := "http://" + lis.Addr().String()
+	p := geecache.NewHTTPPool(self)
+	srv := geecache.NewServer(p, opts...)
+	go srv.Serve(lis)
+	return srv, p, self
+}
+
+// 记录收到的离开通知和转移过来的key的节点
+type recordingPeer struct {
+	mu     sync.Mutex
+	leaves []string
+	sets   []*geecachepb.SetRequest
+}
+
+func (p *recordingPeer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/_leave"):
+		p.leaves = append(p.leaves, string(body))
+	case strings.HasSuffix(r.URL.Path, "/_transfer"):
+		in := &geecachepb.TransferRequest{}
+		proto.Unmarshal(body, in)
+		p.sets = append(p.sets, in.GetEntries()...)
+	default:
+		// 让Get失败，由本地加载
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestServerShutdownAnnouncesLeave(t *testing.T) {
+	// 离开通知要能证明是节点自己发出的，这里用HMAC认证，名字就是节点地址
+	secret := []byte("cluster-secret")
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := "http://" + lis.Addr().String()
+	pool := geecache.NewHTTPPool(self, geecache.WithAuthenticator(geecache.NewHMACAuth(self, secret)))
+	srv := geecache.NewServer(pool)
+	go srv.Serve(lis)
+	// 另一个节点的哈希环上有它自己和将要离开的节点
+	other := geecache.NewHTTPPool("http://other", geecache.WithAuthenticator(geecache.NewHMACAuth("http://other", secret)))
+	other.Set("http://other", self)
+	otherSrv := httptest.NewServer(other)
+	defer otherSrv.Close()
+	pool.Set(self, otherSrv.URL)
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"Tom", "Jack", "Sam", "k1", "k2"} {
+		if _, ok := other.PickPeer(key); ok {
+			t.Fatalf("%s is still picked to the node that left", key)
+		}
+	}
+	if _, err := http.Get(self + "/_geecache/scores/Tom"); err == nil {
+		t.Fatal("server still accepts requests after Shutdown")
+	}
+}
+
+// 默认配置没有认证也没有mTLS，离开通知也要生效
+func TestServerShutdownDefaultConfig(t *testing.T) {
+	srv, pool, self := startServer(t)
+	_, other, otherAddr := startServer(t)
+	other.Set(otherAddr, self)
+	pool.Set(self, otherAddr)
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if _, ok := other.PickPeer(fmt.Sprintf("key%d", i)); ok {
+			t.Fatalf("key%d is still picked to the node that left", i)
+		}
+	}
+}
+
+// 配置了认证时只能为自己发离开通知
+func TestLeaveRequiresIdentity(t *testing.T) {
+	secret := []byte("cluster-secret")
+	for _, tt := range []struct {
+		name   string
+		auth   geecache.Authenticator // 节点的认证方式
+		caller geecache.Authenticator // 调用方的凭证
+		want   int
+	}{
+		{"no authentication", nil, nil, http.StatusNoContent},
+		{"someone else", geecache.NewHMACAuth("http://node", secret), geecache.NewHMACAuth("http://mallory", secret), http.StatusForbidden},
+		{"itself", geecache.NewHMACAuth("http://node", secret), geecache.NewHMACAuth("http://victim", secret), http.StatusNoContent},
+	} {
+		var opts []geecache.HTTPPoolOption
+		if tt.auth != nil {
+			opts = append(opts, geecache.WithAuthenticator(tt.auth))
+		}
+		pool := geecache.NewHTTPPool("http://node", opts...)
+		pool.Set("http://node", "http://victim")
+		srv := httptest.NewServer(pool)
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/_geecache/_leave", strings.NewReader("http://victim"))
+		if tt.caller != nil {
+			token, _ := tt.caller.Token(context.Background())
+			req.Header.Set("Authorization", token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.want {
+			t.Fatalf("%s: leave = %d, want %d", tt.name, res.StatusCode, tt.want)
+		}
+		// 被拒绝时victim仍然在哈希环上
+		_, picked := pool.PickPeer("Tom")
+		for i := 0; !picked && i < 100; i++ {
+			_, picked = pool.PickPeer(fmt.Sprintf("key%d", i))
+		}
+		if picked != (tt.want != http.StatusNoContent) {
+			t.Fatalf("%s: victim still on the ring = %v", tt.name, picked)
+		}
+	}
+}
+
+func TestServerShutdownHandoff(t *testing.T) {
+	rec := &recordingPeer{}
+	recSrv := httptest.NewServer(rec)
+	defer recSrv.Close()
+	srv, pool, self := startServer(t, geecache.WithHandoff(2))
+	pool.Set(self, recSrv.URL)
+	gee := geecache.NewGroup("server-handoff-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v"), nil
+		},
+	))
+	gee.RegisterPeers(pool)
+	// 其他节点负责的key请求失败后也会从本地加载，都在mainCache中
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		gee.Get(key)
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.leaves) != 1 || rec.leaves[0] != self {
+		t.Fatalf("leaves = %v, want [%s]", rec.leaves, self)
+	}
+	// 只剩一个节点，最近访问的两个key都交给了它
+	if len(rec.sets) != 2 {
+		t.Fatalf("got %d handoffs, want 2", len(rec.sets))
+	}
+	for i, want := range []string{"k5", "k4"} {
+		in := rec.sets[i]
+		if in.GetKey() != want || !in.GetReplica() || string(in.GetValue()) != "v" {
+			t.Fatalf("handoff %d = %v, want %s", i, in, want)
+		}
+	}
+}
+
+func TestServerShutdownDrains(t *testing.T) {
+	srv, pool, self := startServer(t)
+	pool.Set(self)
+	started, release := make(chan struct{}), make(chan struct{})
+	geecache.NewGroup("server-drain-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			close(started)
+			<-release
+			return []byte("v"), nil
+		},
+	)).RegisterPeers(pool)
+
+	status := make(chan int, 1)
+	go func() {
+		res, err := http.Get(self + "/_geecache/server-drain-scores/Tom")
+		if err != nil {
+			status <- 0
+			return
+		}
+		res.Body.Close()
+		status <- res.StatusCode
+	}()
+	<-started
+	done := make(chan error, 1)
+	go func() { done <- srv.Shutdown(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v before the load finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if code := <-status; code != http.StatusOK {
+		t.Fatalf("in-flight request got status %d, want 200", code)
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	srv, pool, self := startServer(t)
+	pool.Set(self)
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	gee := geecache.NewGroup("server-timeout-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			close(started)
+			<-release
+			return []byte("v"), nil
+		},
+	))
+	gee.RegisterPeers(pool)
+	go gee.Get("Tom")
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,82 @@
+package geecache_test
+
+import (
+	"context"
+	"fmt"
+	"mikucache/geecache"
+	"mikucache/geecache/geecachepb"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	source := map[string]string{}
+	gee := geecache.NewGroup("set-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := source[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		},
+	), geecache.WithSetter(geecache.SetterFunc(
+		func(key string, value []byte) error {
+			source[key] = string(value)
+			return nil
+		},
+	)))
+	if err := gee.Set("Tom", []byte("700")); err != nil {
+		t.Fatal(err)
+	}
+	if source["Tom"] != "700" {
+		t.Fatalf("value was not written through to the source")
+	}
+	delete(source, "Tom")
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "700" {
+		t.Fatalf("get Tom after set = %s, %v", view, err)
+	}
+}
+
+func TestSetToPeer(t *testing.T) {
+	gee := geecache.NewGroup("peer-set-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		},
+	))
+	peer := &fakePeer{}
+	gee.RegisterPeers(peer)
+	if err := gee.Set("Tom", []byte("700")); err != nil {
+		t.Fatal(err)
+	}
+	if len(peer.sets) != 1 || string(peer.sets[0].GetValue()) != "700" {
+		t.Fatalf("set was not forwarded to the owner: %v", peer.sets)
+	}
+}
+
+func TestHTTPPoolPut(t *testing.T) {
+	gee := geecache.NewGroup("http-set-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		},
+	))
+	srv := httptest.NewServer(geecache.NewHTTPPool("http://server"))
+	defer srv.Close()
+
+	local := geecache.NewHTTPPool("http://local")
+	local.Set("http://local", srv.URL)
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprintf("key%d", i)
+		peer, ok := local.PickPeer(k)
+		if !ok {
+			continue
+		}
+		in := &geecachepb.SetRequest{Group: "http-set-scores", Key: k, Value: []byte("v")}
+		if err := peer.Set(context.Background(), in); err != nil {
+			t.Fatal(err)
+		}
+		if view, err := gee.Get(k); err != nil || view.String() != "v" {
+			t.Fatalf("get %s after put = %s, %v", k, view, err)
+		}
+		return
+	}
+	t.Fatal("no key was picked to the remote peer")
+}
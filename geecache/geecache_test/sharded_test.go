@@ -0,0 +1,77 @@
+package geecache_test
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mikucache/geecache"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardedCache(t *testing.T) {
+	var loads int32
+	const cacheBytes = 1 << 10
+	gee := geecache.NewGroup("sharded-scores", cacheBytes, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return []byte("value-" + key), nil
+		},
+	), geecache.WithShards(8))
+
+	for i := 0; i < 10; i++ {
+		gee.Get(fmt.Sprintf("key%d", i))
+	}
+	for i := 0; i < 10; i++ {
+		if view, err := gee.Get(fmt.Sprintf("key%d", i)); err != nil || view.String() != fmt.Sprintf("value-key%d", i) {
+			t.Fatalf("get key%d = %s, %v", i, view, err)
+		}
+	}
+	if n := atomic.LoadInt32(&loads); n != 10 {
+		t.Fatalf("loads = %d, want 10", n)
+	}
+	if err := gee.Remove("key0"); err != nil {
+		t.Fatal(err)
+	}
+	if cs := gee.CacheStats(geecache.MainCache); cs.Items != 9 || cs.Hits != 10 {
+		t.Fatalf("main cache stats = %+v", cs)
+	}
+
+	// 每个分片最多cacheBytes/8，所有分片加起来不会超过cacheBytes
+	for i := 0; i < 1000; i++ {
+		gee.Get(fmt.Sprintf("more%d", i))
+	}
+	if cs := gee.CacheStats(geecache.MainCache); cs.Bytes > cacheBytes || cs.Evictions == 0 {
+		t.Fatalf("main cache stats = %+v", cs)
+	}
+}
+
+// 比较不分片和分片时并发读的性能，go test -bench Parallel -cpu 1,4,16
+func BenchmarkGetParallel(b *testing.B) {
+	// 每次命中都会打日志，日志本身的锁会掩盖缓存的锁竞争
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			gee := geecache.NewGroup(fmt.Sprintf("bench-sharded-%d", shards), 64<<20, geecache.GetterFunc(
+				func(key string) ([]byte, error) {
+					return []byte("value-" + key), nil
+				},
+			), geecache.WithShards(shards))
+			keys := make([]string, 1024)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key%d", i)
+				gee.Get(keys[i])
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					gee.Get(keys[i%len(keys)])
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package geecache_test
+
+import (
+	"bytes"
+	"errors"
+	"mikucache/geecache"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 每个value都是"v"，一条记录占3字节
+func snapshotGetter(loads *int32) geecache.Getter {
+	return geecache.GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(loads, 1)
+		return []byte("v"), nil
+	})
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	var loads int32
+	// 只能放下3条记录
+	before := geecache.NewGroup("snapshot-scores", 9, snapshotGetter(&loads))
+	before.Get("k1")
+	before.Get("k2")
+	before.Get("k3")
+	var buf bytes.Buffer
+	if err := before.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟重启：同名的Group从快照恢复
+	loads = 0
+	after := geecache.NewGroup("snapshot-scores", 9, snapshotGetter(&loads))
+	if err := after.Restore(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"k1", "k2", "k3"} {
+		if view, err := after.Get(key); err != nil || view.String() != "v" {
+			t.Fatalf("Get(%s) = %q, %v", key, view.String(), err)
+		}
+	}
+	if loads != 0 {
+		t.Fatalf("loads = %d after restore, want 0", loads)
+	}
+}
+
+func TestRestoreLRUOrder(t *testing.T) {
+	var loads int32
+	before := geecache.NewGroup("snapshot-order-scores", 9, snapshotGetter(&loads))
+	before.Get("k1")
+	before.Get("k2")
+	before.Get("k3")
+	before.Get("k1") // LRU顺序变为 k2, k3, k1
+	var buf bytes.Buffer
+	if err := before.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loads = 0
+	after := geecache.NewGroup("snapshot-order-scores", 9, snapshotGetter(&loads))
+	if err := after.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// 最久没有访问的k2先被淘汰
+	after.Get("k4")
+	after.Get("k1")
+	after.Get("k3")
+	if loads != 1 {
+		t.Fatalf("loads = %d, want only k4 to be loaded", loads)
+	}
+	after.Get("k2")
+	if loads != 2 {
+		t.Fatalf("loads = %d, k2 should have been evicted", loads)
+	}
+}
+
+func TestRestoreSkipsExpired(t *testing.T) {
+	var loads int32
+	getter := geecache.TTLGetterFunc(func(key string) ([]byte, time.Duration, error) {
+		atomic.AddInt32(&loads, 1)
+		if key == "short" {
+			return []byte("v"), 20 * time.Millisecond, nil
+		}
+		return []byte("v"), time.Hour, nil
+	})
+	before := geecache.NewGroup("snapshot-ttl-scores", 2<<10, getter)
+	before.Get("short")
+	before.Get("long")
+	var buf bytes.Buffer
+	if err := before.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	loads = 0
+	after := geecache.NewGroup("snapshot-ttl-scores", 2<<10, getter)
+	if err := after.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// 过期时间也被保存了
+	if view, _ := after.Get("long"); view.Expire().IsZero() || loads != 0 {
+		t.Fatalf("long: expire = %v, loads = %d", view.Expire(), loads)
+	}
+	after.Get("short")
+	if loads != 1 {
+		t.Fatalf("loads = %d, the expired key should be loaded again", loads)
+	}
+}
+
+func TestRestoreNotFound(t *testing.T) {
+	var loads int32
+	before := geecache.NewGroup("snapshot-negative-scores", 2<<10, notFoundGetter(&loads),
+		geecache.WithNegativeTTL(time.Hour))
+	before.Get("unknown")
+	var buf bytes.Buffer
+	if err := before.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loads = 0
+	after := geecache.NewGroup("snapshot-negative-scores", 2<<10, notFoundGetter(&loads),
+		geecache.WithNegativeTTL(time.Hour))
+	if err := after.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := after.Get("unknown"); !errors.Is(err, geecache.ErrNotFound) || loads != 0 {
+		t.Fatalf("Get(unknown) = %v, loads = %d", err, loads)
+	}
+}
+
+func TestRestoreBadSnapshot(t *testing.T) {
+	var loads int32
+	gee := geecache.NewGroup("snapshot-bad-scores", 2<<10, snapshotGetter(&loads))
+	gee.Get("Tom")
+	var buf bytes.Buffer
+	if err := gee.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	target := geecache.NewGroup("snapshot-bad-target", 2<<10, snapshotGetter(&loads))
+	flipped := bytes.Clone(data)
+	flipped[len(flipped)-6] ^= 0xff
+	cases := map[string][]byte{
+		"empty":     nil,
+		"not magic": []byte("hello world"),
+		"truncated": data[:len(data)-3],
+		"flipped":   flipped,
+	}
+	for name, data := range cases {
+		if err := gee.Restore(bytes.NewReader(data)); !errors.Is(err, geecache.ErrBadSnapshot) {
+			t.Errorf("%s: Restore = %v, want ErrBadSnapshot", name, err)
+		}
+	}
+	// 快照只能恢复到同名的Group
+	if err := target.Restore(bytes.NewReader(data)); err == nil {
+		t.Fatal("restoring a snapshot into another group should fail")
+	}
+}
+
+func TestWithSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores.snap")
+	var loads int32
+	before := geecache.NewGroup("snapshot-file-scores", 2<<10, snapshotGetter(&loads),
+		geecache.WithSnapshot(path, 10*time.Millisecond))
+	before.Get("Tom")
+	// 等待定期保存
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("snapshot file was not written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := before.SnapshotFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loads = 0
+	after := geecache.NewGroup("snapshot-file-scores", 2<<10, snapshotGetter(&loads),
+		geecache.WithSnapshot(path, 0))
+	if _, err := after.Get("Tom"); err != nil || loads != 0 {
+		t.Fatalf("Get(Tom) = %v, loads = %d after warm restart", err, loads)
+	}
+}
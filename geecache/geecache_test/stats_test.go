@@ -0,0 +1,72 @@
+package geecache_test
+
+import (
+	"fmt"
+	"mikucache/geecache"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	gee := geecache.NewGroup("stats-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		},
+	))
+	gee.Get("Tom")
+	gee.Get("Tom")
+	gee.Get("unknown")
+
+	stats := &gee.Stats
+	if stats.Gets.Get() != 3 || stats.CacheHits.Get() != 1 || stats.Loads.Get() != 2 {
+		t.Fatalf("gets = %s, hits = %s, loads = %s", &stats.Gets, &stats.CacheHits, &stats.Loads)
+	}
+	if stats.LocalLoads.Get() != 1 || stats.LocalLoadErrs.Get() != 1 {
+		t.Fatalf("local loads = %s, local load errs = %s", &stats.LocalLoads, &stats.LocalLoadErrs)
+	}
+
+	// 每次load之前还会再查一次缓存，所以2次load多出2次get
+	cs := gee.CacheStats(geecache.MainCache)
+	want := geecache.CacheStats{Bytes: int64(len("Tom") + len(db["Tom"])), Items: 1, Gets: 5, Hits: 1}
+	if cs != want {
+		t.Fatalf("main cache stats = %+v, want %+v", cs, want)
+	}
+}
+
+// 第一次Test时先Get同一个key，外层的load开始时值已经在缓存中了
+type racingFilter struct {
+	g    *geecache.Group
+	done bool
+}
+
+func (f *racingFilter) Test(key string) bool {
+	if !f.done {
+		f.done = true
+		f.g.Get(key)
+	}
+	return true
+}
+
+func TestStatsRecheckHit(t *testing.T) {
+	filter := &racingFilter{}
+	gee := geecache.NewGroup("stats-recheck", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		},
+	), geecache.WithKeyFilter(filter))
+	filter.g = gee
+	if _, err := gee.Get("Tom"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := &gee.Stats
+	// 两次Get都是load，其中只有一次真正调用了Getter
+	if stats.Gets.Get()-stats.CacheHits.Get() != stats.Loads.Get() {
+		t.Fatalf("gets = %s, hits = %s, loads = %s", &stats.Gets, &stats.CacheHits, &stats.Loads)
+	}
+	if stats.Loads.Get() != 2 || stats.LoadsDeduped.Get() != 1 || stats.RecheckHits.Get() != 1 {
+		t.Fatalf("loads = %s, deduped = %s, recheck hits = %s", &stats.Loads, &stats.LoadsDeduped, &stats.RecheckHits)
+	}
+}
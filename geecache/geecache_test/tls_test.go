@@ -0,0 +1,186 @@
+package geecache_test
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mikucache/geecache"
+	"mikucache/geecache/certs"
+	"mikucache/geecache/geecachepb"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	geecache.NewGroup("tls-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("value-" + key), nil
+		},
+	))
+}
+
+func newTestCA(t *testing.T) *certs.CA {
+	t.Helper()
+	ca, err := certs.NewCA("test-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func tlsConfig(t *testing.T, ca *certs.CA, name string) *tls.Config {
+	t.Helper()
+	cfg, err := ca.Config(name, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// 启动HTTPS节点，返回它的地址
+func startTLSServer(t *testing.T, opts ...geecache.HTTPPoolOption) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := "https://" + lis.Addr().String()
+	srv := geecache.NewServer(geecache.NewHTTPPool(self, opts...))
+	go srv.Serve(lis)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return self
+}
+
+// 通过pool从remote节点获取key
+func getVia(pool geecache.PeerPicker, key string) error {
+	peer, ok := pool.PickPeer(key)
+	if !ok {
+		return fmt.Errorf("%s was not picked to a remote peer", key)
+	}
+	res := &geecachepb.Response{}
+	return peer.Get(&geecachepb.Request{Group: "tls-scores", Key: key}, res)
+}
+
+func TestHTTPPoolTLS(t *testing.T) {
+	ca := newTestCA(t)
+	remote := startTLSServer(t, geecache.WithTLSConfig(tlsConfig(t, ca, "node-a")))
+
+	client := geecache.NewHTTPPool("https://local", geecache.WithTLSConfig(tlsConfig(t, ca, "node-b")))
+	client.Set(remote)
+	peer, _ := client.PickPeer("Tom")
+	res := &geecachepb.Response{}
+	if err := peer.Get(&geecachepb.Request{Group: "tls-scores", Key: "Tom"}, res); err != nil {
+		t.Fatal(err)
+	}
+	if string(res.GetValue()) != "value-Tom" {
+		t.Fatalf("Get(Tom) = %q", res.GetValue())
+	}
+
+	// 没有配置TLS的客户端和其他CA签发的证书都连不上
+	plain := geecache.NewHTTPPool("http://plain")
+	plain.Set(remote)
+	if err := getVia(plain, "Tom"); err == nil {
+		t.Fatal("plaintext client should not be able to talk to a TLS peer")
+	}
+	stranger := geecache.NewHTTPPool("https://stranger", geecache.WithTLSConfig(tlsConfig(t, newTestCA(t), "node-b")))
+	stranger.Set(remote)
+	if err := getVia(stranger, "Tom"); err == nil {
+		t.Fatal("client with a certificate from another CA should be rejected")
+	}
+}
+
+func TestHTTPPoolPeerAllowlist(t *testing.T) {
+	ca := newTestCA(t)
+	remote := startTLSServer(t,
+		geecache.WithTLSConfig(tlsConfig(t, ca, "node-a")),
+		geecache.WithPeerAllowlist("node-b"))
+
+	for name, wantErr := range map[string]bool{"node-b": false, "node-c": true} {
+		client := geecache.NewHTTPPool("https://"+name, geecache.WithTLSConfig(tlsConfig(t, ca, name)))
+		client.Set(remote)
+		if err := getVia(client, "Tom"); (err != nil) != wantErr {
+			t.Fatalf("%s: Get = %v, want error %v", name, err, wantErr)
+		}
+	}
+
+	// 客户端也会检查对方的身份
+	client := geecache.NewHTTPPool("https://node-b",
+		geecache.WithTLSConfig(tlsConfig(t, ca, "node-b")),
+		geecache.WithPeerAllowlist("node-x"))
+	client.Set(remote)
+	if err := getVia(client, "Tom"); err == nil {
+		t.Fatal("client should refuse a peer that is not in its allowlist")
+	}
+}
+
+func TestPeerAllowlistUnverifiedCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	// 只要求客户端发送证书，不校验
+	server := tlsConfig(t, ca, "node-a")
+	server.ClientAuth = tls.RequestClientCert
+	remote := startTLSServer(t, geecache.WithTLSConfig(server), geecache.WithPeerAllowlist("node-b"))
+
+	// 其他CA签发的同名证书没有经过校验，不能冒充node-b
+	forged := tlsConfig(t, newTestCA(t), "node-b")
+	forged.RootCAs = server.RootCAs
+	client := geecache.NewHTTPPool("https://node-b", geecache.WithTLSConfig(forged))
+	client.Set(remote)
+	if err := getVia(client, "Tom"); err == nil {
+		t.Fatal("unverified client certificate should not pass the allowlist")
+	}
+}
+
+func TestGRPCPoolTLS(t *testing.T) {
+	ca := newTestCA(t)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := geecache.NewGRPCPool(lis.Addr().String(),
+		geecache.WithGRPCTLSConfig(tlsConfig(t, ca, "node-a")),
+		geecache.WithGRPCPeerAllowlist("node-b"))
+	go server.Serve(lis)
+	defer server.Close()
+
+	for name, wantCode := range map[string]codes.Code{"node-b": codes.OK, "node-c": codes.PermissionDenied} {
+		client := geecache.NewGRPCPool("127.0.0.1:1", geecache.WithGRPCTLSConfig(tlsConfig(t, ca, name)))
+		client.Set(lis.Addr().String())
+		err := getVia(client, "Tom")
+		client.Close()
+		if status.Code(err) != wantCode {
+			t.Fatalf("%s: Get = %v, want %v", name, err, wantCode)
+		}
+	}
+
+	plain := geecache.NewGRPCPool("127.0.0.1:1")
+	defer plain.Close()
+	plain.Set(lis.Addr().String())
+	if err := getVia(plain, "Tom"); err == nil {
+		t.Fatal("plaintext client should not be able to talk to a TLS peer")
+	}
+}
+
+// 使用mTLS时离开通知中的地址必须和调用方证书中的主机名一致
+func TestLeaveWithClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	remote := startTLSServer(t, geecache.WithTLSConfig(tlsConfig(t, ca, "node-a")))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig(t, ca, "node-b")}}
+	for peer, want := range map[string]int{
+		"https://10.0.0.1:8001":  http.StatusForbidden,
+		"https://127.0.0.1:8001": http.StatusNoContent,
+	} {
+		res, err := client.Post(remote+"/_geecache/_leave", "text/plain", strings.NewReader(peer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != want {
+			t.Fatalf("leave %s = %d, want %d", peer, res.StatusCode, want)
+		}
+	}
+}
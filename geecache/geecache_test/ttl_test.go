@@ -0,0 +1,93 @@
+package geecache_test
+
+import (
+	"context"
+	"mikucache/geecache"
+	"mikucache/geecache/lru"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetWithTTL(t *testing.T) {
+	var loads int32
+	gee := geecache.NewGroup("ttl-scores", 2<<10, geecache.TTLGetterFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			atomic.AddInt32(&loads, 1)
+			return []byte(db[key]), 50 * time.Millisecond, nil
+		},
+	))
+	if view, err := gee.Get("Tom"); err != nil || view.String() != db["Tom"] {
+		t.Fatalf("failed to get value of Tom: %v", err)
+	}
+	if view, _ := gee.Get("Tom"); view.Expire().IsZero() {
+		t.Fatal("value loaded by TTLGetter should have an expire time")
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Fatalf("loads = %d before expire, want 1", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := gee.Get("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("loads = %d after expire, want 2", n)
+	}
+}
+
+// 同时实现了ContextGetter和TTLGetter
+type ctxTTLGetter struct{}
+
+func (ctxTTLGetter) Get(key string) ([]byte, error) { return []byte(db[key]), nil }
+
+func (ctxTTLGetter) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return []byte(db[key]), nil
+}
+
+func (ctxTTLGetter) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return []byte(db[key]), time.Hour, nil
+}
+
+func TestGetterTTLPrecedence(t *testing.T) {
+	for name, getter := range map[string]geecache.Getter{
+		"both": ctxTTLGetter{},
+		"combined": geecache.ContextTTLGetterFunc(func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+			return []byte(db[key]), time.Hour, nil
+		}),
+	} {
+		gee := geecache.NewGroup("ttl-precedence-"+name, 2<<10, getter)
+		view, err := gee.Get("Tom")
+		if err != nil || view.String() != db["Tom"] {
+			t.Fatalf("%s: Get = %v, %v", name, view, err)
+		}
+		if view.Expire().IsZero() {
+			t.Fatalf("%s: ttl returned by getter was ignored", name)
+		}
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	evicted := make(chan lru.EvictReason, 1)
+	gee := geecache.NewGroup("janitor-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		},
+	),
+		geecache.WithTTL(10*time.Millisecond),
+		geecache.WithJanitor(5*time.Millisecond),
+		geecache.WithOnEvicted(func(key string, value geecache.ByteView, reason lru.EvictReason) {
+			evicted <- reason
+		}),
+	)
+	if _, err := gee.Get("Jack"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case reason := <-evicted:
+		if reason != lru.EvictExpired {
+			t.Fatalf("evicted with %v, want %v", reason, lru.EvictExpired)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("janitor did not remove the expired value")
+	}
+}
@@ -0,0 +1,541 @@
+package gossip
+
+/*
+gossip 实现了一个简化版的 SWIM 成员协议：
+1. 每隔 ProbeInterval 轮流挑一个节点发送 ping，ProbeTimeout 内没有收到 ack，
+   就请 IndirectChecks 个其他节点帮忙 ping 它（ping-req），避免因为自己和目标之间的网络抖动误判；
+2. 间接探测也失败的节点被标记为 suspect，SuspicionTimeout 内没有反驳就认为它已经 dead；
+3. 被怀疑的节点收到关于自己的 suspect 消息时，增加自己的 incarnation 来反驳；
+4. 所有消息都捎带(piggyback)完整的成员列表，节点状态就这样在集群中传播开。
+节点加入(alive)时调用 Membership.AddPeer，dead 或主动离开(left)时调用 Membership.RemovePeer，
+哈希环就能自动跟着集群变化。所有消息都是 UDP 上的 JSON，只适合几十个节点以内的集群。
+
+gossip 消息会直接修改哈希环，不经过 geecache 节点之间的认证。设置了 Config.Secret 时，
+每个消息都带有用它计算的 HMAC-SHA256 签名，签名不对的消息直接丢弃；
+没有设置 Secret 时任何能访问 UDP 端口的主机都能增删节点，只能在可信的网络中使用。
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"mikucache/geecache/discovery"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const maxPacketSize = 65507 // UDP包的最大长度
+
+// State 是节点的状态，数值越大优先级越高（相同incarnation时）
+type State int
+
+const (
+	StateAlive State = iota
+	StateSuspect
+	StateDead
+	StateLeft
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	case StateLeft:
+		return "left"
+	}
+	return "unknown"
+}
+
+type Config struct {
+	Name     string   // 节点的名字，也就是加入哈希环的地址，比如 http://localhost:8001
+	BindAddr string   // UDP监听地址，比如 127.0.0.1:7946，端口为0时随机分配
+	Seeds    []string // 种子节点的UDP地址，启动时通过它们加入集群
+
+	ProbeInterval    time.Duration // 探测间隔，默认1秒
+	ProbeTimeout     time.Duration // 等待ack的时间，默认300毫秒
+	IndirectChecks   int           // 间接探测时请多少个节点帮忙，默认3个
+	SuspicionTimeout time.Duration // suspect多久没有反驳就认为dead，默认5秒
+
+	// 节点加入或离开时通知哈希环，可以直接传 geecache.HTTPPool
+	Membership discovery.Membership
+
+	// 集群共享的密钥，用来签名和校验所有消息，为空时不签名（只能在可信的网络中使用）
+	Secret []byte
+}
+
+type member struct {
+	Name        string    `json:"name"`
+	Addr        string    `json:"addr"`
+	State       State     `json:"state"`
+	Incarnation uint64    `json:"inc"`
+	changed     time.Time // 状态最后一次变化的时间
+}
+
+// 在哈希环上的节点：alive和suspect都还算在集群里
+func (m *member) active() bool {
+	return m.State == StateAlive || m.State == StateSuspect
+}
+
+type msgType int
+
+const (
+	msgPing msgType = iota
+	msgAck
+	msgPingReq
+)
+
+type message struct {
+	Type    msgType  `json:"type"`
+	Seq     uint64   `json:"seq"`
+	Target  string   `json:"target,omitempty"` // ping-req要探测的节点UDP地址
+	Members []member `json:"members,omitempty"`
+}
+
+// 需要在锁外通知Membership的成员变化
+type event struct {
+	name string
+	join bool
+}
+
+type Node struct {
+	cfg  Config
+	conn *net.UDPConn
+	seq  atomic.Uint64
+
+	mu      sync.Mutex
+	self    *member
+	members map[string]*member       // 除自己以外的节点，包括dead和left的墓碑，避免旧消息把它们复活
+	acks    map[uint64]chan struct{} // 等待ack的探测
+	probes  []string                 // 本轮还没探测的节点，打乱顺序后轮流探测
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// New 监听UDP端口，把自己加入哈希环，并通过种子节点加入集群
+func New(cfg Config) (*Node, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("gossip: Name is required")
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = time.Second
+	}
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = 300 * time.Millisecond
+	}
+	if cfg.IndirectChecks <= 0 {
+		cfg.IndirectChecks = 3
+	}
+	if cfg.SuspicionTimeout <= 0 {
+		cfg.SuspicionTimeout = 5 * time.Second
+	}
+	addr, err := net.ResolveUDPAddr("udp", cfg.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{
+		cfg:  cfg,
+		conn: conn,
+		self: &member{
+			Name:    cfg.Name,
+			Addr:    conn.LocalAddr().String(),
+			State:   StateAlive,
+			changed: time.Now(),
+		},
+		members: make(map[string]*member),
+		acks:    make(map[uint64]chan struct{}),
+		stop:    make(chan struct{}),
+	}
+	if cfg.Membership != nil {
+		cfg.Membership.AddPeer(cfg.Name)
+	}
+	n.wg.Add(2)
+	go n.readLoop()
+	go n.probeLoop()
+	n.joinSeeds()
+	return n, nil
+}
+
+// Addr 返回实际监听的UDP地址
+func (n *Node) Addr() string {
+	return n.self.Addr
+}
+
+// Members 返回集群中所有活着的节点的名字，包括自己
+func (n *Node) Members() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	names := []string{n.self.Name}
+	for _, m := range n.members {
+		if m.active() {
+			names = append(names, m.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Leave 通知其他节点自己主动离开，然后停止
+func (n *Node) Leave() {
+	n.mu.Lock()
+	n.self.State = StateLeft
+	n.self.Incarnation++
+	var addrs []string
+	for _, m := range n.members {
+		if m.active() {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	n.mu.Unlock()
+	for _, addr := range addrs {
+		n.send(addr, message{Type: msgPing, Seq: n.seq.Add(1)})
+	}
+	n.Shutdown()
+}
+
+// Shutdown 直接停止，不通知其他节点，其他节点会通过探测发现它已经dead
+func (n *Node) Shutdown() {
+	n.stopOnce.Do(func() {
+		close(n.stop)
+		n.conn.Close()
+		n.wg.Wait()
+	})
+}
+
+func (n *Node) joinSeeds() {
+	for _, seed := range n.cfg.Seeds {
+		if seed != n.self.Addr {
+			n.send(seed, message{Type: msgPing, Seq: n.seq.Add(1)})
+		}
+	}
+}
+
+func (n *Node) readLoop() {
+	defer n.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		size, from, err := n.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-n.stop:
+				return
+			default:
+			}
+			log.Println("[Gossip] read failed:", err)
+			continue
+		}
+		payload, ok := n.verify(buf[:size])
+		if !ok {
+			log.Println("[Gossip] dropped message with a bad signature from", from)
+			continue
+		}
+		var msg message
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			log.Println("[Gossip] decode message failed:", err)
+			continue
+		}
+		n.handle(msg, from.String())
+	}
+}
+
+func (n *Node) handle(msg message, from string) {
+	n.mergeAll(msg.Members)
+	switch msg.Type {
+	case msgPing:
+		n.send(from, message{Type: msgAck, Seq: msg.Seq})
+	case msgAck:
+		n.mu.Lock()
+		if ch, ok := n.acks[msg.Seq]; ok {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		n.mu.Unlock()
+	case msgPingReq:
+		// 帮请求方探测目标节点，收到ack后用请求方的seq回复它。
+		// handle在readLoop中调用，这时wg不为0，可以安全地Add，Shutdown会等它结束
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			if n.ping(msg.Target, n.cfg.ProbeTimeout) {
+				n.send(from, message{Type: msgAck, Seq: msg.Seq})
+			}
+		}()
+	}
+}
+
+func (n *Node) probeLoop() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+		n.probe()
+		n.reapSuspects()
+	}
+}
+
+// 探测一个节点，直接和间接探测都失败时把它标记为suspect
+func (n *Node) probe() {
+	target, ok := n.nextProbe()
+	if !ok {
+		// 还不认识任何节点，重新通过种子节点加入
+		n.joinSeeds()
+		return
+	}
+	seq, ch := n.register()
+	defer n.unregister(seq)
+	n.send(target.Addr, message{Type: msgPing, Seq: seq})
+	if n.wait(ch, n.cfg.ProbeTimeout) {
+		return
+	}
+	for _, helper := range n.randomMembers(n.cfg.IndirectChecks, target.Name) {
+		n.send(helper.Addr, message{Type: msgPingReq, Seq: seq, Target: target.Addr})
+	}
+	// 间接探测要多走一个来回
+	if n.wait(ch, 2*n.cfg.ProbeTimeout) {
+		return
+	}
+	n.suspect(target.Name)
+}
+
+// 直接ping一个地址，在timeout内收到ack返回true
+func (n *Node) ping(addr string, timeout time.Duration) bool {
+	seq, ch := n.register()
+	defer n.unregister(seq)
+	n.send(addr, message{Type: msgPing, Seq: seq})
+	return n.wait(ch, timeout)
+}
+
+func (n *Node) register() (uint64, chan struct{}) {
+	seq := n.seq.Add(1)
+	ch := make(chan struct{}, 1)
+	n.mu.Lock()
+	n.acks[seq] = ch
+	n.mu.Unlock()
+	return seq, ch
+}
+
+func (n *Node) unregister(seq uint64) {
+	n.mu.Lock()
+	delete(n.acks, seq)
+	n.mu.Unlock()
+}
+
+func (n *Node) wait(ch chan struct{}, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return true
+	case <-timer.C:
+		return false
+	case <-n.stop:
+		return false
+	}
+}
+
+// 轮流返回下一个要探测的节点，每一轮开始时打乱顺序
+func (n *Node) nextProbe() (member, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for {
+		if len(n.probes) == 0 {
+			for name, m := range n.members {
+				if m.active() {
+					n.probes = append(n.probes, name)
+				}
+			}
+			if len(n.probes) == 0 {
+				return member{}, false
+			}
+			rand.Shuffle(len(n.probes), func(i, j int) {
+				n.probes[i], n.probes[j] = n.probes[j], n.probes[i]
+			})
+		}
+		name := n.probes[0]
+		n.probes = n.probes[1:]
+		if m, ok := n.members[name]; ok && m.active() {
+			return *m, true
+		}
+	}
+}
+
+// 随机挑选最多k个活着的节点，不包括exclude
+func (n *Node) randomMembers(k int, exclude string) []member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var candidates []member
+	for name, m := range n.members {
+		if name != exclude && m.State == StateAlive {
+			candidates = append(candidates, *m)
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+func (n *Node) suspect(name string) {
+	n.mu.Lock()
+	m, ok := n.members[name]
+	if ok && m.State == StateAlive {
+		m.State = StateSuspect
+		m.changed = time.Now()
+		log.Printf("[Gossip] %s suspects %s", n.cfg.Name, name)
+	}
+	n.mu.Unlock()
+}
+
+// suspect超过SuspicionTimeout还没有反驳的节点认为已经dead
+func (n *Node) reapSuspects() {
+	var events []event
+	n.mu.Lock()
+	for name, m := range n.members {
+		if m.State == StateSuspect && time.Since(m.changed) >= n.cfg.SuspicionTimeout {
+			m.State = StateDead
+			m.changed = time.Now()
+			events = append(events, event{name: name})
+			log.Printf("[Gossip] %s marks %s dead", n.cfg.Name, name)
+		}
+	}
+	n.mu.Unlock()
+	n.notify(events)
+}
+
+func (n *Node) mergeAll(updates []member) {
+	var events []event
+	n.mu.Lock()
+	for _, u := range updates {
+		if e, ok := n.merge(u); ok {
+			events = append(events, e)
+		}
+	}
+	n.mu.Unlock()
+	n.notify(events)
+}
+
+// 合并一条成员状态，调用时持有n.mu，成员加入或离开哈希环时返回对应的event
+func (n *Node) merge(u member) (event, bool) {
+	if u.Name == n.self.Name {
+		// 别人认为自己出问题了，增加incarnation反驳
+		if u.State != StateAlive && u.Incarnation >= n.self.Incarnation && n.self.State == StateAlive {
+			n.self.Incarnation = u.Incarnation + 1
+		}
+		return event{}, false
+	}
+	m, ok := n.members[u.Name]
+	if !ok {
+		m = &u
+		m.changed = time.Now()
+		n.members[u.Name] = m
+		return event{name: u.Name, join: true}, m.active()
+	}
+	// incarnation大的消息更新；incarnation相同时，状态优先级高的更新
+	if u.Incarnation < m.Incarnation || (u.Incarnation == m.Incarnation && u.State <= m.State) {
+		return event{}, false
+	}
+	wasActive := m.active()
+	m.Addr, m.State, m.Incarnation, m.changed = u.Addr, u.State, u.Incarnation, time.Now()
+	if wasActive != m.active() {
+		return event{name: u.Name, join: m.active()}, true
+	}
+	return event{}, false
+}
+
+func (n *Node) notify(events []event) {
+	for _, e := range events {
+		if e.join {
+			log.Printf("[Gossip] %s sees %s join", n.cfg.Name, e.name)
+		} else {
+			log.Printf("[Gossip] %s sees %s leave", n.cfg.Name, e.name)
+		}
+		if n.cfg.Membership == nil {
+			continue
+		}
+		if e.join {
+			n.cfg.Membership.AddPeer(e.name)
+		} else {
+			n.cfg.Membership.RemovePeer(e.name)
+		}
+	}
+}
+
+// 发送消息，捎带上自己知道的所有成员状态
+func (n *Node) send(addr string, msg message) {
+	n.mu.Lock()
+	msg.Members = make([]member, 0, len(n.members)+1)
+	msg.Members = append(msg.Members, *n.self)
+	for _, m := range n.members {
+		msg.Members = append(msg.Members, *m)
+	}
+	n.mu.Unlock()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("[Gossip] encode message failed:", err)
+		return
+	}
+	data = n.sign(data)
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		log.Println("[Gossip] resolve address failed:", err)
+		return
+	}
+	if _, err := n.conn.WriteToUDP(data, udpAddr); err != nil {
+		select {
+		case <-n.stop:
+		default:
+			log.Println("[Gossip] send failed:", err)
+		}
+	}
+}
+
+// 设置了Secret时在消息前面加上签名
+func (n *Node) sign(payload []byte) []byte {
+	if len(n.cfg.Secret) == 0 {
+		return payload
+	}
+	mac := hmac.New(sha256.New, n.cfg.Secret)
+	mac.Write(payload)
+	return append(mac.Sum(nil), payload...)
+}
+
+// 校验并去掉签名，没有设置Secret时原样返回
+func (n *Node) verify(data []byte) ([]byte, bool) {
+	if len(n.cfg.Secret) == 0 {
+		return data, true
+	}
+	if len(data) < sha256.Size {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, n.cfg.Secret)
+	mac.Write(data[sha256.Size:])
+	if !hmac.Equal(mac.Sum(nil), data[:sha256.Size]) {
+		return nil, false
+	}
+	return data[sha256.Size:], true
+}
@@ -0,0 +1,151 @@
+package gossip
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeMembership struct {
+	mu    sync.Mutex
+	peers map[string]bool
+}
+
+func (m *fakeMembership) AddPeer(peers ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range peers {
+		m.peers[p] = true
+	}
+}
+
+func (m *fakeMembership) RemovePeer(peers ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range peers {
+		delete(m.peers, p)
+	}
+}
+
+func (m *fakeMembership) list() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var peers []string
+	for p := range m.peers {
+		peers = append(peers, p)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+func startNode(t *testing.T, name string, seeds ...string) (*Node, *fakeMembership) {
+	t.Helper()
+	return startSecretNode(t, nil, name, seeds...)
+}
+
+// 用secret签名消息的节点
+func startSecretNode(t *testing.T, secret []byte, name string, seeds ...string) (*Node, *fakeMembership) {
+	t.Helper()
+	m := &fakeMembership{peers: make(map[string]bool)}
+	n, err := New(Config{
+		Name:             name,
+		BindAddr:         "127.0.0.1:0",
+		Seeds:            seeds,
+		ProbeInterval:    20 * time.Millisecond,
+		ProbeTimeout:     10 * time.Millisecond,
+		SuspicionTimeout: 100 * time.Millisecond,
+		Membership:       m,
+		Secret:           secret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(n.Shutdown)
+	return n, m
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJoinAndFailure(t *testing.T) {
+	n1, m1 := startNode(t, "node1")
+	n2, m2 := startNode(t, "node2", n1.Addr())
+	n3, _ := startNode(t, "node3", n1.Addr())
+
+	all := []string{"node1", "node2", "node3"}
+	for i, n := range []*Node{n1, n2, n3} {
+		waitFor(t, fmt.Sprintf("node%d to see all members", i+1), func() bool {
+			return reflect.DeepEqual(n.Members(), all)
+		})
+	}
+	if got := m1.list(); !reflect.DeepEqual(got, all) {
+		t.Fatalf("node1 ring = %v, want %v", got, all)
+	}
+
+	// node3直接退出，其他节点通过探测发现它失败了
+	n3.Shutdown()
+	alive := []string{"node1", "node2"}
+	waitFor(t, "node3 to be removed", func() bool {
+		return reflect.DeepEqual(m1.list(), alive) && reflect.DeepEqual(m2.list(), alive)
+	})
+}
+
+func TestLeave(t *testing.T) {
+	n1, m1 := startNode(t, "node1")
+	n2, _ := startNode(t, "node2", n1.Addr())
+	waitFor(t, "node1 to see node2", func() bool {
+		return len(n1.Members()) == 2
+	})
+	n2.Leave()
+	// 主动离开的节点立即被移除，不需要等待SuspicionTimeout
+	waitFor(t, "node2 to leave", func() bool {
+		return reflect.DeepEqual(m1.list(), []string{"node1"})
+	})
+}
+
+func TestRefuteSuspicion(t *testing.T) {
+	n1, _ := startNode(t, "node1")
+	n2, _ := startNode(t, "node2", n1.Addr())
+	waitFor(t, "node1 to see node2", func() bool {
+		return len(n1.Members()) == 2
+	})
+	// node1错误地怀疑node2，node2收到消息后增加incarnation反驳
+	n1.suspect("node2")
+	waitFor(t, "node2 to refute", func() bool {
+		n1.mu.Lock()
+		defer n1.mu.Unlock()
+		return n1.members["node2"].State == StateAlive
+	})
+	if got := n2.Members(); len(got) != 2 {
+		t.Fatalf("node2 members = %v", got)
+	}
+}
+
+func TestSecret(t *testing.T) {
+	secret := []byte("cluster-secret")
+	n1, m1 := startSecretNode(t, secret, "node1")
+	n2, _ := startSecretNode(t, secret, "node2", n1.Addr())
+	// 没有密钥和密钥不对的节点发来的消息都被丢弃
+	startNode(t, "intruder", n1.Addr())
+	startSecretNode(t, []byte("guess"), "guesser", n1.Addr())
+
+	want := []string{"node1", "node2"}
+	waitFor(t, "signed nodes to join", func() bool {
+		return reflect.DeepEqual(m1.list(), want) && reflect.DeepEqual(n2.Members(), want)
+	})
+	time.Sleep(100 * time.Millisecond)
+	if got := m1.list(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ring of node1 = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,733 @@
+package geecache
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"mikucache/geecache/consistenthash"
+	"mikucache/geecache/geecachepb"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const defaultGRPCTimeout = 3 * time.Second
+
+// GRPCPool 和 HTTPPool 一样实现了 PeerPicker，只是节点之间改用 gRPC 通信
+// 每个远程节点对应一个长连接 grpc.ClientConn，基于 HTTP/2 多路复用
+type GRPCPool struct {
+	self        string // 本节点地址，形如 localhost:8001，不带协议前缀
+	timeout     time.Duration
+	dialOpts    []grpc.DialOption
+	serverOpts  []grpc.ServerOption
+	mu          sync.Mutex
+	peers       *consistenthash.Map    // 一致性哈希算法的map，用来根据key选择节点
+	nodes       map[string]bool        // 哈希环上的所有节点，包括自己
+	grpcGetters map[string]*grpcGetter // 每一个远程节点对应一个gRPC客户端
+	server      *grpc.Server
+	replication int         // 每个key存放在几个节点上，<=1表示不复制
+	rebalancer  *rebalancer // 哈希环变化之后转移key，为nil时不转移
+	tlsConfig   *tls.Config
+	allowlist   peerAllowlist
+	auth        Authenticator // 认证请求并给发出的请求加上凭证，为nil时不认证
+	// 集群级操作（离开通知）的权限，为nil时不限制
+	clusterPolicy Policy
+	// Shutdown时交给新的负责节点的热点key数量，0表示不交接
+	handoff int
+}
+
+// GRPCPoolOption 用来配置 GRPCPool
+type GRPCPoolOption func(*GRPCPool)
+
+// WithGRPCTimeout 设置调用远程节点的超时时间，ctx 自带 deadline 时以 ctx 为准，0表示不限制
+func WithGRPCTimeout(d time.Duration) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.timeout = d
+	}
+}
+
+// WithDialOptions 追加创建客户端连接时的选项，比如 TLS 证书
+func WithDialOptions(opts ...grpc.DialOption) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.dialOpts = append(p.dialOpts, opts...)
+	}
+}
+
+// WithServerOptions 追加 Serve 创建 grpc.Server 时的选项
+func WithServerOptions(opts ...grpc.ServerOption) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.serverOpts = append(p.serverOpts, opts...)
+	}
+}
+
+// WithGRPCReplication 和 WithReplication 一样，把每个key存放在哈希环上连续的n个节点上
+func WithGRPCReplication(n int) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.replication = n
+	}
+}
+
+// WithGRPCRebalance 和 WithRebalance 一样，节点列表变化之后把不再由自己负责的key转移给新的负责节点
+func WithGRPCRebalance(topN int, bytesPerSec int64) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.rebalancer = newRebalancer(p, topN, bytesPerSec)
+	}
+}
+
+// WithGRPCTLSConfig 和 WithTLSConfig 一样，cfg同时用于Serve启动的服务端和访问其他节点的客户端。
+// 使用Register注册到自己的grpc.Server时，服务端的证书需要调用方自己配置
+func WithGRPCTLSConfig(cfg *tls.Config) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.tlsConfig = cfg
+	}
+}
+
+// WithGRPCPeerAllowlist 和 WithPeerAllowlist 一样，只接受证书身份在ids中的节点
+func WithGRPCPeerAllowlist(ids ...string) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.allowlist = newPeerAllowlist(ids)
+	}
+}
+
+// WithGRPCAuthenticator 和 WithAuthenticator 一样，凭证放在authorization元数据中，
+// 认证失败返回codes.Unauthenticated，没有Group的权限返回codes.PermissionDenied
+func WithGRPCAuthenticator(auth Authenticator) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.auth = auth
+	}
+}
+
+// WithGRPCClusterPolicy 和 WithClusterPolicy 一样，离开通知需要PermMembership，推送副本和转移key需要PermWrite
+func WithGRPCClusterPolicy(policy Policy) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.clusterPolicy = policy
+	}
+}
+
+// WithGRPCHandoff 和 WithHandoff 一样，Shutdown时每个Group把最热的n个key推送给它们新的负责节点
+func WithGRPCHandoff(n int) GRPCPoolOption {
+	return func(p *GRPCPool) {
+		p.handoff = n
+	}
+}
+
+func NewGRPCPool(self string, opts ...GRPCPoolOption) *GRPCPool {
+	p := &GRPCPool{
+		self:     self,
+		timeout:  defaultGRPCTimeout,
+		dialOpts: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.tlsConfig != nil {
+		// 后设置的TransportCredentials会覆盖默认的insecure
+		p.dialOpts = append(p.dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(p.allowlist.clientConfig(p.tlsConfig))))
+		p.serverOpts = append(p.serverOpts, grpc.Creds(credentials.NewTLS(p.tlsConfig)))
+	}
+	if p.auth != nil {
+		p.dialOpts = append(p.dialOpts, grpc.WithPerRPCCredentials(tokenCredentials{p.auth}))
+	}
+	return p
+}
+
+// tokenCredentials 把Authenticator的凭证放到每次调用的authorization元数据中
+type tokenCredentials struct {
+	auth Authenticator
+}
+
+func (c tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := c.auth.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": token}, nil
+}
+
+// 和HTTPPool一样，不要求TLS，没有配置WithGRPCTLSConfig时凭证以明文传输
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// 发来请求的连接的TLS状态，明文连接返回nil
+func tlsState(ctx context.Context) *tls.ConnectionState {
+	if pr, ok := peer.FromContext(ctx); ok {
+		if info, ok := pr.AuthInfo.(credentials.TLSInfo); ok {
+			return &info.State
+		}
+	}
+	return nil
+}
+
+// 检查发来请求的节点是否在WithGRPCPeerAllowlist的名单中
+func (p *GRPCPool) checkPeer(ctx context.Context) error {
+	if p.allowlist.allowed(tlsState(ctx)) {
+		return nil
+	}
+	return status.Error(codes.PermissionDenied, "peer not allowed")
+}
+
+// 认证发来请求的调用方，返回它的名字
+func (p *GRPCPool) authenticate(ctx context.Context) (string, error) {
+	var token string
+	if tokens := metadata.ValueFromIncomingContext(ctx, "authorization"); len(tokens) > 0 {
+		token = tokens[0]
+	}
+	caller, err := authenticate(ctx, p.auth, token)
+	if err != nil {
+		return "", status.Error(codes.Unauthenticated, err.Error())
+	}
+	return caller, nil
+}
+
+func (p *GRPCPool) Log(format string, v ...any) {
+	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// Set 更新节点列表，已经存在的节点复用原来的连接，被移除的节点关闭连接。
+// 每个peer是ParsePeerSpec格式的 "地址" 或者 "地址 权重"，格式错误的会被跳过
+func (p *GRPCPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.nodes = make(map[string]bool, len(peers))
+	getters := make(map[string]*grpcGetter, len(peers))
+	for _, spec := range peers {
+		peer, weight, err := ParsePeerSpec(spec)
+		if err != nil {
+			p.Log("%v", err)
+			continue
+		}
+		p.peers.AddWeighted(peer, weight)
+		p.nodes[peer] = true
+		if g, ok := p.grpcGetters[peer]; ok {
+			getters[peer] = g
+			continue
+		}
+		if peer == p.self {
+			continue
+		}
+		g, err := newGRPCGetter(peer, p.timeout, p.dialOpts...)
+		if err != nil {
+			p.Log("create client for %s failed: %v", peer, err)
+			continue
+		}
+		getters[peer] = g
+	}
+	for peer, g := range p.grpcGetters {
+		if _, ok := getters[peer]; !ok {
+			g.close()
+		}
+	}
+	p.grpcGetters = getters
+	p.rebalancer.notify()
+}
+
+// AddPeer 往哈希环上增加节点，不影响已有的节点；节点已经存在但权重不同时修改它的权重
+func (p *GRPCPool) AddPeer(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		p.peers = consistenthash.New(defaultReplicas, nil)
+		p.nodes = make(map[string]bool, len(peers))
+		p.grpcGetters = make(map[string]*grpcGetter, len(peers))
+	}
+	for _, spec := range peers {
+		peer, weight, err := ParsePeerSpec(spec)
+		if err != nil {
+			p.Log("%v", err)
+			continue
+		}
+		if p.nodes[peer] {
+			if p.peers.Weight(peer) != weight {
+				p.peers.AddWeighted(peer, weight)
+				p.Log("Set weight of peer %s to %d", peer, weight)
+			}
+			continue
+		}
+		if peer != p.self {
+			g, err := newGRPCGetter(peer, p.timeout, p.dialOpts...)
+			if err != nil {
+				p.Log("create client for %s failed: %v", peer, err)
+				continue
+			}
+			p.grpcGetters[peer] = g
+		}
+		p.nodes[peer] = true
+		p.peers.AddWeighted(peer, weight)
+		p.Log("Add peer %s", peer)
+	}
+	p.rebalancer.notify()
+}
+
+// RemovePeer 从哈希环上删除节点，并关闭到它的连接。和HTTPPool一样，带权重并且权重不同时忽略
+func (p *GRPCPool) RemovePeer(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, spec := range peers {
+		peer, weight, err := parseRemoveSpec(spec)
+		if err != nil {
+			p.Log("%v", err)
+			continue
+		}
+		if !p.nodes[peer] || weight != 0 && p.peers.Weight(peer) != weight {
+			continue
+		}
+		delete(p.nodes, peer)
+		p.peers.Remove(peer)
+		if g, ok := p.grpcGetters[peer]; ok {
+			g.close()
+			delete(p.grpcGetters, peer)
+		}
+		p.Log("Remove peer %s", peer)
+	}
+	p.rebalancer.notify()
+}
+
+// 删除节点，不管它的权重是多少
+func (p *GRPCPool) removeNode(peer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.nodes[peer] {
+		return
+	}
+	delete(p.nodes, peer)
+	p.peers.Remove(peer)
+	if g, ok := p.grpcGetters[peer]; ok {
+		g.close()
+		delete(p.grpcGetters, peer)
+	}
+	p.Log("Remove peer %s", peer)
+	// 自己离开时由Shutdown负责交接，不需要再转移
+	if peer != p.self {
+		p.rebalancer.notify()
+	}
+}
+
+// Rebalance 和 HTTPPool.Rebalance 一样，立即转移不再由自己负责的key
+func (p *GRPCPool) Rebalance(ctx context.Context) error {
+	return p.rebalancer.run(ctx)
+}
+
+// PickPeer 根据key选择远程节点，选中自己或者没有节点时返回false
+func (p *GRPCPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		if g, ok := p.grpcGetters[peer]; ok {
+			p.Log("Pick peer %s", peer)
+			return g, true
+		}
+	}
+	return nil, false
+}
+
+// Register 把 GroupCache 服务注册到调用方自己的 grpc.Server 上
+func (p *GRPCPool) Register(s grpc.ServiceRegistrar) {
+	geecachepb.RegisterGroupCacheServer(s, &grpcServer{pool: p})
+}
+
+// Serve 在lis上启动gRPC服务，阻塞直到服务停止
+func (p *GRPCPool) Serve(lis net.Listener) error {
+	s := grpc.NewServer(p.serverOpts...)
+	p.Register(s)
+	p.mu.Lock()
+	p.server = s
+	p.mu.Unlock()
+	return s.Serve(lis)
+}
+
+// Close 停止gRPC服务和哈希环变化后的后台转移，并关闭所有到远程节点的连接
+func (p *GRPCPool) Close() {
+	p.rebalancer.stop()
+	p.stopServer(context.Background())
+	p.closeClients()
+}
+
+// 停止gRPC服务，GracefulStop等待进行中的请求结束，ctx结束时改为直接Stop
+func (p *GRPCPool) stopServer(ctx context.Context) error {
+	p.mu.Lock()
+	s := p.server
+	p.server = nil
+	p.mu.Unlock()
+	// GracefulStop 会等待进行中的请求结束，而请求可能还会调用 PickPeer，所以不能持锁
+	if s == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
+
+func (p *GRPCPool) closeClients() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, g := range p.grpcGetters {
+		g.close()
+	}
+	// 连接都已关闭，哈希环也一起清空，之后还可以重新 Set 或 AddPeer
+	clear(p.grpcGetters)
+	clear(p.nodes)
+	p.peers = nil
+}
+
+// Shutdown 和 Server.Shutdown 一样优雅地关闭节点：
+//  1. 通知其他所有节点把自己从哈希环上删除；
+//  2. 配置了WithGRPCHandoff时，把热点key推送给它们新的负责节点；
+//  3. 停止gRPC服务，等待正在处理的请求结束；
+//  4. 等待正在进行的加载结束，最后关闭到其他节点的连接。
+//
+// ctx结束时不再等待，返回ctx.Err()。通知和交接失败只会记录日志，不影响关闭
+func (p *GRPCPool) Shutdown(ctx context.Context) error {
+	// 之后的哈希环变化不再转移key，要转移的热点key由下面的handOff发送
+	p.rebalancer.stop()
+	p.leave(ctx)
+	// 自己也不再负责任何key，之后本地的Get都会转发给新的负责节点
+	p.removeNode(p.self)
+	groups := groupsUsing(p)
+	if p.handoff > 0 {
+		for _, g := range groups {
+			// 保留mainCache中的值，退出前还可能要保存快照
+			if err := g.handOff(ctx, p.handoff, nil, false); err != nil {
+				log.Println("[MikuCache] Failed to hand off hot keys", err)
+			}
+		}
+	}
+	err := p.stopServer(ctx)
+	for _, g := range groups {
+		err = errors.Join(err, g.loader.Wait(ctx))
+	}
+	p.closeClients()
+	return err
+}
+
+// 通知其他所有节点自己将要离开
+func (p *GRPCPool) leave(ctx context.Context) {
+	p.mu.Lock()
+	getters := make(map[string]*grpcGetter, len(p.grpcGetters))
+	for peer, getter := range p.grpcGetters {
+		getters[peer] = getter
+	}
+	p.mu.Unlock()
+	for peer, getter := range getters {
+		if err := getter.leave(ctx, p.self); err != nil {
+			p.Log("Failed to announce leave to %s: %v", peer, err)
+		}
+	}
+}
+
+// PickReplicas 返回负责key的replication个节点，自己用nil表示，连接创建失败的节点会被跳过
+func (p *GRPCPool) PickReplicas(key string) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil
+	}
+	var peers []PeerGetter
+	for _, node := range p.peers.GetN(key, max(p.replication, 1)) {
+		if node == p.self {
+			peers = append(peers, nil)
+		} else if g, ok := p.grpcGetters[node]; ok {
+			peers = append(peers, g)
+		}
+	}
+	return peers
+}
+
+// 返回除自己以外的所有节点，用来广播缓存失效
+func (p *GRPCPool) AllPeers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]PeerGetter, 0, len(p.grpcGetters))
+	for _, getter := range p.grpcGetters {
+		peers = append(peers, getter)
+	}
+	return peers
+}
+
+func (p *GRPCPool) peerStats() map[string]*peerStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[string]*peerStats, len(p.grpcGetters))
+	for peer, getter := range p.grpcGetters {
+		stats[peer] = &getter.stats
+	}
+	return stats
+}
+
+var (
+	_ PeerPicker    = (*GRPCPool)(nil)
+	_ PeerLister    = (*GRPCPool)(nil)
+	_ ReplicaPicker = (*GRPCPool)(nil)
+)
+
+// ---------------------grpcServer 服务端，处理其他节点发来的请求--------------------
+
+type grpcServer struct {
+	geecachepb.UnimplementedGroupCacheServer
+	pool *GRPCPool
+}
+
+// 检查节点身份和调用方的凭证，返回调用方的名字
+func (s *grpcServer) caller(ctx context.Context) (string, error) {
+	if err := s.pool.checkPeer(ctx); err != nil {
+		return "", err
+	}
+	return s.pool.authenticate(ctx)
+}
+
+// 检查节点身份和调用方的凭证，返回调用方有perm权限的group
+func (s *grpcServer) group(ctx context.Context, name string, perm Permission) (*Group, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.authorize(caller, name, perm)
+}
+
+func (s *grpcServer) authorize(caller, name string, perm Permission) (*Group, error) {
+	group, err := authorizeGroup(s.pool.clusterPolicy, name, caller, perm)
+	if errors.Is(err, ErrPermissionDenied) {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return group, nil
+}
+
+// 推送副本和转移key只有集群中的节点能做，需要集群的PermWrite
+func (s *grpcServer) authorizePeer(caller string) error {
+	if err := authorizeCluster(s.pool.clusterPolicy, caller, PermWrite); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+func (s *grpcServer) Get(ctx context.Context, in *geecachepb.Request) (*geecachepb.Response, error) {
+	group, err := s.group(ctx, in.GetGroup(), PermRead)
+	if err != nil {
+		return nil, err
+	}
+	s.pool.Log("GET %s/%s", in.GetGroup(), in.GetKey())
+	group.Stats.ServerRequests.Add(1)
+	view, err := group.GetContext(ctx, in.GetKey())
+	// key不存在不算错误，放在Response里返回，codes.NotFound留给group不存在的情况
+	if errors.Is(err, ErrNotFound) {
+		return &geecachepb.Response{NotFound: true}, nil
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return newResponse(view), nil
+}
+
+func (s *grpcServer) Delete(ctx context.Context, in *geecachepb.DeleteRequest) (*geecachepb.DeleteResponse, error) {
+	group, err := s.group(ctx, in.GetGroup(), PermDelete)
+	if err != nil {
+		return nil, err
+	}
+	s.pool.Log("DELETE %s/%s", in.GetGroup(), in.GetKey())
+	if err = group.removeFromPeer(ctx, in); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &geecachepb.DeleteResponse{}, nil
+}
+
+func (s *grpcServer) Set(ctx context.Context, in *geecachepb.SetRequest) (*geecachepb.SetResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	group, err := s.authorize(caller, in.GetGroup(), PermWrite)
+	if err != nil {
+		return nil, err
+	}
+	// 副本不写数据源，只有集群中的节点能推送
+	if in.GetReplica() {
+		if err = s.authorizePeer(caller); err != nil {
+			return nil, err
+		}
+	}
+	s.pool.Log("SET %s/%s", in.GetGroup(), in.GetKey())
+	if err = group.setFromPeer(ctx, in); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &geecachepb.SetResponse{}, nil
+}
+
+func (s *grpcServer) GetMulti(ctx context.Context, in *geecachepb.GetMultiRequest) (*geecachepb.GetMultiResponse, error) {
+	group, err := s.group(ctx, in.GetGroup(), PermRead)
+	if err != nil {
+		return nil, err
+	}
+	s.pool.Log("GETMULTI %s (%d keys)", in.GetGroup(), len(in.GetKeys()))
+	return group.getMultiForPeer(ctx, in), nil
+}
+
+func (s *grpcServer) Transfer(ctx context.Context, in *geecachepb.TransferRequest) (*geecachepb.TransferResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.authorizePeer(caller); err != nil {
+		return nil, err
+	}
+	group, err := s.authorize(caller, in.GetGroup(), PermWrite)
+	if err != nil {
+		return nil, err
+	}
+	s.pool.Log("TRANSFER %s (%d keys)", in.GetGroup(), len(in.GetEntries()))
+	group.receiveTransfer(in)
+	return &geecachepb.TransferResponse{}, nil
+}
+
+// 其他节点关闭前通知自己把它从哈希环上删除，规则和HTTPPool的离开通知一样
+func (s *grpcServer) Leave(ctx context.Context, in *geecachepb.LeaveRequest) (*geecachepb.LeaveResponse, error) {
+	caller, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = authorizeCluster(s.pool.clusterPolicy, caller, PermMembership); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	peer := in.GetPeer()
+	if peer == "" || peer == s.pool.self {
+		return nil, status.Errorf(codes.InvalidArgument, "bad peer: %s", peer)
+	}
+	p := s.pool
+	if verifiesIdentity(p.auth, p.allowlist, p.tlsConfig) && !leaveAllowed(tlsState(ctx), caller, peer) {
+		return nil, status.Errorf(codes.PermissionDenied, "cannot leave on behalf of %s", peer)
+	}
+	s.pool.Log("LEAVE %s", peer)
+	s.pool.removeNode(peer)
+	return &geecachepb.LeaveResponse{}, nil
+}
+
+// ---------------------grpcGetter 实现gRPC客户端功能--------------------
+
+type grpcGetter struct {
+	addr    string
+	timeout time.Duration
+	conn    *grpc.ClientConn // 长连接，所有请求在这一条连接上多路复用
+	client  geecachepb.GroupCacheClient
+	stats   peerStats
+}
+
+func newGRPCGetter(addr string, timeout time.Duration, opts ...grpc.DialOption) (*grpcGetter, error) {
+	// grpc.NewClient 不会立即建立连接，第一次调用时才会连接，断开后会自动重连
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcGetter{
+		addr:    addr,
+		timeout: timeout,
+		conn:    conn,
+		client:  geecachepb.NewGroupCacheClient(conn),
+	}, nil
+}
+
+func (g *grpcGetter) Get(in *geecachepb.Request, out *geecachepb.Response) error {
+	return g.GetContext(context.Background(), in, out)
+}
+
+func (g *grpcGetter) GetContext(ctx context.Context, in *geecachepb.Request, out *geecachepb.Response) (err error) {
+	defer func() { g.stats.record(err) }()
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+	res, err := g.client.Get(ctx, in)
+	if err != nil {
+		return err
+	}
+	proto.Merge(out, res)
+	return nil
+}
+
+func (g *grpcGetter) Delete(ctx context.Context, in *geecachepb.DeleteRequest) (err error) {
+	defer func() { g.stats.record(err) }()
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+	_, err = g.client.Delete(ctx, in)
+	return err
+}
+
+func (g *grpcGetter) GetMulti(ctx context.Context, in *geecachepb.GetMultiRequest, out *geecachepb.GetMultiResponse) (err error) {
+	defer func() { g.stats.record(err) }()
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+	res, err := g.client.GetMulti(ctx, in)
+	if err != nil {
+		return err
+	}
+	proto.Merge(out, res)
+	return nil
+}
+
+func (g *grpcGetter) Set(ctx context.Context, in *geecachepb.SetRequest) (err error) {
+	defer func() { g.stats.record(err) }()
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+	_, err = g.client.Set(ctx, in)
+	return err
+}
+
+func (g *grpcGetter) Transfer(ctx context.Context, in *geecachepb.TransferRequest) (err error) {
+	defer func() { g.stats.record(err) }()
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+	_, err = g.client.Transfer(ctx, in)
+	return err
+}
+
+// 通知远程节点自己将要离开
+func (g *grpcGetter) leave(ctx context.Context, self string) (err error) {
+	defer func() { g.stats.record(err) }()
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+	_, err = g.client.Leave(ctx, &geecachepb.LeaveRequest{Peer: self})
+	return err
+}
+
+// ctx没有设置deadline时使用默认的超时时间，超时时间为0时不限制（和HTTPPool一致）
+func (g *grpcGetter) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || g.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, g.timeout)
+}
+
+func (g *grpcGetter) close() {
+	if err := g.conn.Close(); err != nil {
+		log.Printf("[MikuCache] close connection to %s: %v", g.addr, err)
+	}
+}
+
+// 验证grpcGetter结构体是否实现了PeerGetter接口
+var (
+	_ PeerGetter  = (*grpcGetter)(nil)
+	_ Transferrer = (*grpcGetter)(nil)
+)
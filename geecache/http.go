@@ -1,6 +1,10 @@
 package geecache
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -10,13 +14,19 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 )
 
 const (
-	defaultBasePath = "/_geecache/"
-	defaultReplicas = 50
+	defaultBasePath    = "/_geecache/"
+	defaultReplicas    = 50
+	defaultHTTPTimeout = 3 * time.Second
+	// 节点关闭前通知其他节点自己离开，POST basePath+leavePath，body是节点地址
+	leavePath = "_leave"
+	// 批量转移缓存值，POST basePath+transferPath，body是序列化后的TransferRequest
+	transferPath = "_transfer"
 )
 
 type HTTPPool struct {
@@ -25,25 +35,198 @@ type HTTPPool struct {
 	mu          sync.Mutex
 	peers       *consistenthash.Map    // 一致性哈希算法的map，用来根据key选择节点
 	httpGetters map[string]*httpGetter // 每一个远程节点对应一个http客户端
+	// 以下是每个httpGetter的配置
+	timeout          time.Duration
+	retry            retryPolicy
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	// 负责key的节点熔断时，是否沿着哈希环改为请求下一个可用的节点
+	reroute bool
+	// 每个key存放在几个节点上，<=1表示不复制
+	replication int
+	// 哈希环变化之后转移key，为nil时不转移
+	rebalancer *rebalancer
+	// 节点之间的TLS配置和允许的节点身份，见WithTLSConfig和WithPeerAllowlist
+	tlsConfig *tls.Config
+	allowlist peerAllowlist
+	client    *http.Client // 访问其他节点的客户端，没有配置TLS时是http.DefaultClient
+	// 认证请求并给发出的请求加上凭证，为nil时不认证
+	auth Authenticator
+	// 集群级操作（离开通知、metrics）的权限，为nil时不限制
+	clusterPolicy Policy
 }
 
-func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+// HTTPPoolOption 用来配置 HTTPPool
+type HTTPPoolOption func(*HTTPPool)
+
+// WithHTTPTimeout 设置每次请求远程节点的超时时间，默认3秒，0表示不限制
+func WithHTTPTimeout(d time.Duration) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.timeout = d
+	}
+}
+
+// WithRetries 设置请求远程节点遇到网络错误、超时或502/503/504时最多重试retries次，
+// 第一次重试前等待backoff，之后每次翻倍
+func WithRetries(retries int, backoff time.Duration) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.retry = retryPolicy{retries: retries, backoff: backoff}
+	}
+}
+
+// WithCircuitBreaker 为每个远程节点启用熔断器：连续失败threshold次之后，
+// cooldown时间内的请求直接返回ErrCircuitOpen，不再等待一个已经挂掉的节点
+func WithCircuitBreaker(threshold int, cooldown time.Duration) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.breakerThreshold = threshold
+		p.breakerCooldown = cooldown
+	}
+}
+
+// WithRerouting 负责key的节点熔断时，PickPeer沿着哈希环选择下一个可用的节点，
+// 轮到自己时返回false，由本节点加载
+func WithRerouting() HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.reroute = true
+	}
+}
+
+// WithReplication 把每个key存放在哈希环上连续的n个节点上，读取时依次尝试这些节点，
+// 从数据源加载或写入的值会推送给所有副本节点，这样一个节点挂掉时它负责的key不会全部失效
+func WithReplication(n int) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.replication = n
+	}
+}
+
+// WithRebalance 在节点列表变化之后，把每个Group的mainCache中不再由自己负责的key
+// 批量转移给新的负责节点，新节点不用再从数据源加载。每个Group最多转移最近访问的topN个key
+// （<=0表示不限制），转移的速度不超过bytesPerSec字节每秒（<=0表示不限制）
+func WithRebalance(topN int, bytesPerSec int64) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.rebalancer = newRebalancer(p, topN, bytesPerSec)
+	}
+}
+
+// WithTLSConfig 节点之间使用TLS通信，节点地址要以https://开头。cfg同时用于服务端和访问其他节点的客户端：
+// Certificates是自己的证书，RootCAs用来校验其他节点的证书；开启双向TLS时还要设置ClientCAs和ClientAuth，
+// certs包可以生成这样的配置。服务端需要使用Server，它会以cfg启动HTTPS
+func WithTLSConfig(cfg *tls.Config) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.tlsConfig = cfg
+	}
+}
+
+// WithPeerAllowlist 只接受证书身份（CommonName、DNS名、IP或URI）在ids中的节点发来的请求，
+// 访问其他节点时也会检查对方的证书。需要配合双向TLS使用，没有客户端证书的请求一律拒绝
+func WithPeerAllowlist(ids ...string) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.allowlist = newPeerAllowlist(ids)
+	}
+}
+
+// WithAuthenticator 设置认证方式：收到的请求必须带有auth认可的凭证，否则返回401；
+// 访问其他节点时带上auth.Token()。认证得到的调用方名字用来检查Group的WithPolicy
+func WithAuthenticator(auth Authenticator) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.auth = auth
+	}
+}
+
+// WithClusterPolicy 设置集群级操作的权限：离开通知需要PermMembership，推送副本和转移key需要PermWrite，
+// Guard保护的接口（比如/metrics）需要各自指定的权限。请求的Group不存在时也按它检查。默认不限制
+func WithClusterPolicy(policy Policy) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.clusterPolicy = policy
+	}
+}
+
+func NewHTTPPool(self string, opts ...HTTPPoolOption) *HTTPPool {
+	p := &HTTPPool{
 		self:     self, // 启动服务器的url
 		basePath: defaultBasePath,
+		timeout:  defaultHTTPTimeout,
+		client:   http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	if p.tlsConfig != nil {
+		p.client = &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   p.allowlist.clientConfig(p.tlsConfig),
+			ForceAttemptHTTP2: true,
+		}}
+	}
+	return p
+}
+
+// 按照pool的配置创建httpGetter
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	getter := NewhtthttpGetter(peer, p.basePath)
+	getter.timeout = p.timeout
+	getter.retry = p.retry
+	getter.breaker = newCircuitBreaker(p.breakerThreshold, p.breakerCooldown)
+	getter.client = p.client
+	getter.auth = p.auth
+	return getter
 }
 
 func (p *HTTPPool) Log(format string, v ...any) {
 	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
 }
 
+// 检查节点身份并认证调用方，失败时写入错误响应并返回false
+func (p *HTTPPool) checkRequest(w http.ResponseWriter, r *http.Request) (caller string, ok bool) {
+	if !p.allowlist.allowedRequest(r) {
+		http.Error(w, "peer not allowed", http.StatusForbidden)
+		return "", false
+	}
+	caller, err := AuthenticateHTTP(p.auth, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return "", false
+	}
+	return caller, true
+}
+
+// Guard 让h和节点之间的请求使用同样的检查：节点身份名单、Authenticator认证，
+// 以及WithClusterPolicy中的perm权限，用来保护挂在同一个端口上的其他接口，比如/metrics
+func (p *HTTPPool) Guard(perm Permission, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, ok := p.checkRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := authorizeCluster(p.clusterPolicy, caller, perm); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
 		http.Error(w, "Unexpected path: "+r.URL.Path, http.StatusNotFound)
 		return
 	}
+	caller, ok := p.checkRequest(w, r)
+	if !ok {
+		return
+	}
 	p.Log("%s %s", r.Method, r.URL.Path)
+	switch r.URL.Path {
+	case p.basePath + leavePath:
+		if err := authorizeCluster(p.clusterPolicy, caller, PermMembership); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		p.serveLeave(w, r, caller)
+		return
+	case p.basePath + transferPath:
+		p.serveTransfer(w, r, caller)
+		return
+	}
 
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
@@ -52,18 +235,121 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	groupName := parts[0]
 	key := parts[1]
-	group := GetGroup(groupName)
-	if group == nil {
-		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+	perm, ok := methodPerms[r.Method]
+	if !ok {
+		http.Error(w, "method not allowed: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+	group, err := authorizeGroup(p.clusterPolicy, groupName, caller, perm)
+	if err != nil {
+		writeGroupError(w, err)
 		return
 	}
 
-	view, err := group.Get(key)
+	switch r.Method {
+	case http.MethodGet:
+		p.serveGet(w, r, group, key)
+	case http.MethodDelete:
+		p.serveDelete(w, r, group, key)
+	case http.MethodPut:
+		p.servePut(w, r, group, key, caller)
+	case http.MethodPost:
+		p.serveGetMulti(w, r, group)
+	}
+}
+
+// authorizeGroup的错误：没有权限返回403，Group不存在返回404
+func writeGroupError(w http.ResponseWriter, err error) {
+	code := http.StatusNotFound
+	if errors.Is(err, ErrPermissionDenied) {
+		code = http.StatusForbidden
+	}
+	http.Error(w, err.Error(), code)
+}
+
+// 每种请求需要的Group权限
+var methodPerms = map[string]Permission{
+	http.MethodGet:    PermRead,
+	http.MethodPost:   PermRead, // GetMulti
+	http.MethodPut:    PermWrite,
+	http.MethodDelete: PermDelete,
+}
+
+func (p *HTTPPool) serveGet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	group.Stats.ServerRequests.Add(1)
+	view, err := group.GetContext(r.Context(), key)
+	// key不存在时返回404，body仍然是Response，客户端据此区分是key不存在还是group不存在
+	code := http.StatusOK
+	if errors.Is(err, ErrNotFound) {
+		code, view = http.StatusNotFound, ByteView{notFound: true}
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err := proto.Marshal(newResponse(view))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	body, err := proto.Marshal(&geecachepb.Response{Value: view.ByteSlice()})
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// DELETE /<basepath>/<groupname>/<key>?broadcast=true
+func (p *HTTPPool) serveDelete(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	in := &geecachepb.DeleteRequest{
+		Group:     group.name,
+		Key:       key,
+		Broadcast: r.URL.Query().Get("broadcast") == "true",
+	}
+	if err := group.removeFromPeer(r.Context(), in); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PUT /<basepath>/<groupname>/<key>，body是序列化后的SetRequest
+func (p *HTTPPool) servePut(w http.ResponseWriter, r *http.Request, group *Group, key, caller string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in := &geecachepb.SetRequest{}
+	if err = proto.Unmarshal(body, in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in.Group, in.Key = group.name, key
+	// 副本不写数据源，只有集群中的节点能推送
+	if in.GetReplica() {
+		if err = authorizeCluster(p.clusterPolicy, caller, PermWrite); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	if err = group.setFromPeer(r.Context(), in); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /<basepath>/<groupname>/，body是序列化后的GetMultiRequest，返回GetMultiResponse
+func (p *HTTPPool) serveGetMulti(w http.ResponseWriter, r *http.Request, group *Group) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in := &geecachepb.GetMultiRequest{}
+	if err = proto.Unmarshal(body, in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err = proto.Marshal(group.getMultiForPeer(r.Context(), in))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -72,66 +358,493 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
+// 其他节点关闭前通知自己把它从哈希环上删除。只接受节点为自己发出的通知，
+// 身份来自Authenticator认证的名字或者校验过的mTLS证书。
+// 认证和TLS都没有配置时直接接受，否则默认配置下的节点永远无法离开
+func (p *HTTPPool) serveLeave(w http.ResponseWriter, r *http.Request, caller string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<10))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	peer := strings.TrimSpace(string(body))
+	if peer == "" || peer == p.self {
+		http.Error(w, "bad peer: "+peer, http.StatusBadRequest)
+		return
+	}
+	if verifiesIdentity(p.auth, p.allowlist, p.tlsConfig) && !leaveAllowed(r.TLS, caller, peer) {
+		http.Error(w, "cannot leave on behalf of "+peer, http.StatusForbidden)
+		return
+	}
+	p.removeNode(peer)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 其他节点转移过来的key，body是序列化后的TransferRequest
+func (p *HTTPPool) serveTransfer(w http.ResponseWriter, r *http.Request, caller string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in := &geecachepb.TransferRequest{}
+	if err = proto.Unmarshal(body, in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 和推送副本一样，只有集群中的节点能转移key
+	if err = authorizeCluster(p.clusterPolicy, caller, PermWrite); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	group, err := authorizeGroup(p.clusterPolicy, in.GetGroup(), caller, PermWrite)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	group.receiveTransfer(in)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Rebalance 立即把不再由自己负责的key转移给新的负责节点，没有设置WithRebalance时什么也不做。
+// 节点列表变化之后会自动转移，一般不需要调用
+func (p *HTTPPool) Rebalance(ctx context.Context) error {
+	return p.rebalancer.run(ctx)
+}
+
+// 删除节点，不管它的权重是多少
+func (p *HTTPPool) removeNode(peer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil || p.peers.Weight(peer) == 0 {
+		return
+	}
+	p.peers.Remove(peer)
+	delete(p.httpGetters, peer)
+	p.Log("Remove peer %s", peer)
+	// 自己离开时由Server.Shutdown负责交接，不需要再转移
+	if peer != p.self {
+		p.rebalancer.notify()
+	}
+}
+
+// Set 用peers替换整个节点列表，已经存在的节点复用原来的httpGetter。
+// 每个peer是ParsePeerSpec格式的 "地址" 或者 "地址 权重"，格式错误的会被跳过
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	// 创建一致性哈希map，虚拟节点数设置为默认的50，算法采用默认的crc32.ChecksumIEEE
 	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
-	for _, peer := range peers {
-		p.httpGetters[peer] = NewhtthttpGetter(peer, p.basePath)
+	getters := make(map[string]*httpGetter, len(peers))
+	for _, spec := range peers {
+		peer, weight, err := ParsePeerSpec(spec)
+		if err != nil {
+			p.Log("%v", err)
+			continue
+		}
+		p.peers.AddWeighted(peer, weight)
+		if getter, ok := p.httpGetters[peer]; ok {
+			getters[peer] = getter
+			continue
+		}
+		getters[peer] = p.newGetter(peer)
 	}
+	p.httpGetters = getters
+	p.rebalancer.notify()
+}
+
+// AddPeer 往哈希环上增加节点，不影响已有的节点；节点已经存在但权重不同时修改它的权重
+func (p *HTTPPool) AddPeer(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		p.peers = consistenthash.New(defaultReplicas, nil)
+		p.httpGetters = make(map[string]*httpGetter, len(peers))
+	}
+	for _, spec := range peers {
+		peer, weight, err := ParsePeerSpec(spec)
+		if err != nil {
+			p.Log("%v", err)
+			continue
+		}
+		if _, ok := p.httpGetters[peer]; ok {
+			if p.peers.Weight(peer) != weight {
+				p.peers.AddWeighted(peer, weight)
+				p.Log("Set weight of peer %s to %d", peer, weight)
+			}
+			continue
+		}
+		p.peers.AddWeighted(peer, weight)
+		p.httpGetters[peer] = p.newGetter(peer)
+		p.Log("Add peer %s", peer)
+	}
+	p.rebalancer.notify()
+}
+
+// RemovePeer 从哈希环上删除节点。peer不带权重时只按地址删除；带权重并且和节点当前的权重不同时忽略，
+// 这样节点列表中修改了权重时，不管先收到新的AddPeer还是旧的RemovePeer，节点都不会被删掉
+func (p *HTTPPool) RemovePeer(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, spec := range peers {
+		peer, weight, err := parseRemoveSpec(spec)
+		if err != nil {
+			p.Log("%v", err)
+			continue
+		}
+		if _, ok := p.httpGetters[peer]; !ok || weight != 0 && p.peers.Weight(peer) != weight {
+			continue
+		}
+		p.peers.Remove(peer)
+		delete(p.httpGetters, peer)
+		p.Log("Remove peer %s", peer)
+	}
+	p.rebalancer.notify()
 }
 
 // 提供根据选择的key 创建HTTP客户端从远程节点获取缓存只的能力
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+	if p.peers == nil {
+		return nil, false
+	}
+	peer := p.peers.Get(key)
+	if peer == "" {
+		// 哈希环上没有节点
+		return nil, false
+	}
+	if p.reroute && peer != p.self && !p.httpGetters[peer].breaker.available() {
+		// 负责key的节点熔断了，顺着哈希环找下一个可用的节点
+		peer = ""
+		p.peers.Walk(key, func(node string) bool {
+			if node == p.self || p.httpGetters[node].breaker.available() {
+				peer = node
+				return false
+			}
+			return true
+		})
+	}
+	if peer != "" && peer != p.self {
 		p.Log("Pick peer %s", peer)
 		return p.httpGetters[peer], true
 	}
 	return nil, false
 }
 
+// PickReplicas 返回负责key的replication个节点，自己用nil表示
+func (p *HTTPPool) PickReplicas(key string) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil
+	}
+	nodes := p.peers.GetN(key, max(p.replication, 1))
+	peers := make([]PeerGetter, len(nodes))
+	for i, node := range nodes {
+		if node != p.self {
+			peers[i] = p.httpGetters[node]
+		}
+	}
+	return peers
+}
+
+// 返回除自己以外的所有节点，用来广播缓存失效
+func (p *HTTPPool) AllPeers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]PeerGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
+func (p *HTTPPool) peerStats() map[string]*peerStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[string]*peerStats, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			stats[peer] = &getter.stats
+		}
+	}
+	return stats
+}
+
+var (
+	_ PeerLister    = (*HTTPPool)(nil)
+	_ ReplicaPicker = (*HTTPPool)(nil)
+)
+
 // ---------------------Add httpGetter 实现http客户端功能--------------------
 
 type httpGetter struct {
 	baseURL string // 要访问的远程节点的地址
+	stats   peerStats
+	timeout time.Duration // 每次尝试的超时时间，0表示不限制
+	retry   retryPolicy
+	breaker *circuitBreaker // 为nil时不熔断
+	client  *http.Client
+	auth    Authenticator // 为nil时不带凭证
 }
 
 func NewhtthttpGetter(node string, baseUrl string) *httpGetter {
 	return &httpGetter{
 		baseURL: node + baseUrl,
+		timeout: defaultHTTPTimeout,
+		client:  http.DefaultClient,
 	}
 }
+
+// 创建请求，配置了Authenticator时带上凭证
+func (h *httpGetter) newRequest(ctx context.Context, method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if h.auth != nil {
+		token, err := h.auth.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", token)
+	}
+	return req, nil
+}
+
+// statusError 是远程节点返回的非预期状态码
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "server returned: " + e.status
+}
+
+// 只有节点本身的问题才算失败，会被重试并计入熔断：网络错误、超时和网关类的5xx。
+// 调用方取消、4xx以及500(数据源加载失败)不算
+func peerFailure(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code == http.StatusBadGateway || se.code == http.StatusServiceUnavailable || se.code == http.StatusGatewayTimeout
+	}
+	return true
+}
+
+// do 带超时、重试和熔断地执行请求，fn的每次调用都是一次完整的HTTP请求
+func (h *httpGetter) do(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() { h.stats.record(err) }()
+	for attempt := 0; ; attempt++ {
+		if !h.breaker.allow() {
+			return ErrCircuitOpen
+		}
+		err = h.try(ctx, fn)
+		if ctx.Err() != nil {
+			h.breaker.cancel()
+			return err
+		}
+		failed := peerFailure(ctx, err)
+		h.breaker.record(failed)
+		if !failed || attempt >= h.retry.retries {
+			return err
+		}
+		if !sleepContext(ctx, h.retry.delay(attempt)) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (h *httpGetter) try(ctx context.Context, fn func(ctx context.Context) error) error {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
+
 func (h *httpGetter) Get(in *geecachepb.Request, out *geecachepb.Response) error {
+	return h.GetContext(context.Background(), in, out)
+}
+
+func (h *httpGetter) GetContext(ctx context.Context, in *geecachepb.Request, out *geecachepb.Response) error {
 	/*
 			url.QueryEscape 它的主要作用是：
 		1. 将字符串中的特殊字符转换为 URL 编码格式
 		2. 确保 URL 中的参数值能够安全传输，避免特殊字符造成的问题
 	*/
+	u := fmt.Sprintf("%v%v/%v", h.baseURL, url.QueryEscape(in.GetGroup()), url.QueryEscape(in.GetKey()))
+	return h.do(ctx, func(ctx context.Context) error {
+		req, err := h.newRequest(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+		res, err := h.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
 
+		// 404且body是Response时说明key不存在，out.NotFound会被设置
+		keyNotFound := res.StatusCode == http.StatusNotFound && res.Header.Get("Content-Type") == "application/octet-stream"
+		if res.StatusCode != http.StatusOK && !keyNotFound {
+			return &statusError{res.StatusCode, res.Status}
+		}
+		bytes, err := io.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("reading response body: %v", err)
+		}
+		if err = proto.Unmarshal(bytes, out); err != nil {
+			return fmt.Errorf("decoding response body: %v", err)
+		}
+		return nil
+	})
+}
+
+func (h *httpGetter) Delete(ctx context.Context, in *geecachepb.DeleteRequest) error {
 	u := fmt.Sprintf("%v%v/%v", h.baseURL, url.QueryEscape(in.GetGroup()), url.QueryEscape(in.GetKey()))
-	res, err := http.Get(u)
+	if in.GetBroadcast() {
+		u += "?broadcast=true"
+	}
+	return h.do(ctx, func(ctx context.Context) error {
+		req, err := h.newRequest(ctx, http.MethodDelete, u, nil)
+		if err != nil {
+			return err
+		}
+		res, err := h.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			return &statusError{res.StatusCode, res.Status}
+		}
+		return nil
+	})
+}
+
+func (h *httpGetter) Set(ctx context.Context, in *geecachepb.SetRequest) error {
+	body, err := proto.Marshal(in)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
+	u := fmt.Sprintf("%v%v/%v", h.baseURL, url.QueryEscape(in.GetGroup()), url.QueryEscape(in.GetKey()))
+	return h.do(ctx, func(ctx context.Context) error {
+		req, err := h.newRequest(ctx, http.MethodPut, u, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		res, err := h.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
-	}
-	bytes, err := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusNoContent {
+			return &statusError{res.StatusCode, res.Status}
+		}
+		return nil
+	})
+}
+
+func (h *httpGetter) GetMulti(ctx context.Context, in *geecachepb.GetMultiRequest, out *geecachepb.GetMultiResponse) error {
+	body, err := proto.Marshal(in)
 	if err != nil {
-		return fmt.Errorf("reading response body: %v", err)
+		return err
 	}
-	if err = proto.Unmarshal(bytes, out); err != nil {
-		return fmt.Errorf("decoding response body: %v", err)
+	u := fmt.Sprintf("%v%v/", h.baseURL, url.QueryEscape(in.GetGroup()))
+	return h.do(ctx, func(ctx context.Context) error {
+		req, err := h.newRequest(ctx, http.MethodPost, u, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		res, err := h.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return &statusError{res.StatusCode, res.Status}
+		}
+		data, err := io.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("reading response body: %v", err)
+		}
+		if err = proto.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("decoding response body: %v", err)
+		}
+		return nil
+	})
+}
+
+// 通知远程节点self将要离开
+func (h *httpGetter) leave(ctx context.Context, self string) error {
+	u := h.baseURL + leavePath
+	return h.do(ctx, func(ctx context.Context) error {
+		req, err := h.newRequest(ctx, http.MethodPost, u, strings.NewReader(self))
+		if err != nil {
+			return err
+		}
+		res, err := h.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			return &statusError{res.StatusCode, res.Status}
+		}
+		return nil
+	})
+}
+
+// Transfer 把一批缓存值转移给远程节点
+func (h *httpGetter) Transfer(ctx context.Context, in *geecachepb.TransferRequest) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
 	}
-	return nil
+	u := h.baseURL + transferPath
+	return h.do(ctx, func(ctx context.Context) error {
+		req, err := h.newRequest(ctx, http.MethodPost, u, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		res, err := h.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusNoContent {
+			return &statusError{res.StatusCode, res.Status}
+		}
+		return nil
+	})
 }
 
 // 验证httpGetter结构体是否实现了PeerGetter接口
-var _ PeerGetter = (*httpGetter)(nil)
+var (
+	_ PeerGetter  = (*httpGetter)(nil)
+	_ Transferrer = (*httpGetter)(nil)
+)
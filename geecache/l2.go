@@ -0,0 +1,149 @@
+package geecache
+
+import (
+	"log"
+	"mikucache/geecache/lru"
+	"sync"
+	"time"
+)
+
+// L2Cache 是mainCache之后的第二级缓存，diskcache.Store实现了它。
+// mainCache因为容量不足淘汰的值会被写进L2Cache，内存未命中时先查L2Cache再去访问远程节点和数据源
+type L2Cache interface {
+	// Get 返回key的值和过期时间，过期时间为零值表示永不过期
+	Get(key string) (value []byte, expire time.Time, ok bool)
+	Put(key string, value []byte, expire time.Time) error
+	Delete(key string) error
+}
+
+// WithL2Cache 设置第二级缓存，适合数据量比内存大很多，但从本地磁盘读取仍然比数据源快的场景。
+// mainCache淘汰记录时还持有缓存锁，被淘汰的值先放进一个有界的队列，由后台goroutine写进L2Cache，
+// 队列满了就丢弃（计入Stats.L2Drops），L2Cache写得慢不会拖慢Get
+func WithL2Cache(l2 L2Cache) GroupOption {
+	return func(g *Group) {
+		g.l2 = l2
+	}
+}
+
+// 最多有多少个被淘汰的值等待写进L2Cache
+const l2QueueSize = 1024
+
+// 等待写进L2Cache的值
+type l2Queue struct {
+	mu      sync.Mutex
+	pending map[string]ByteView
+	wake    chan struct{}
+	// 写入L2Cache时持有，删除key时要等正在进行的写入结束，否则旧值可能在删除之后才写进去
+	writeMu sync.Mutex
+}
+
+func newL2Queue() *l2Queue {
+	return &l2Queue{
+		pending: make(map[string]ByteView),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// 取出一个等待写入的值
+func (q *l2Queue) pop() (string, ByteView, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for key, value := range q.pending {
+		delete(q.pending, key)
+		return key, value, true
+	}
+	return "", ByteView{}, false
+}
+
+// 取出key等待写入的值，它不需要再写进L2Cache了
+func (q *l2Queue) take(key string) (ByteView, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	value, ok := q.pending[key]
+	delete(q.pending, key)
+	return value, ok
+}
+
+// 包装onEvicted，被淘汰的值放进队列等待写进L2Cache。不存在的key和过期的值不需要保存
+func (g *Group) evictToL2(onEvicted func(string, ByteView, lru.EvictReason)) func(string, ByteView, lru.EvictReason) {
+	return func(key string, value ByteView, reason lru.EvictReason) {
+		if reason == lru.EvictCapacity && !value.notFound {
+			g.enqueueL2(key, value)
+		}
+		if onEvicted != nil {
+			onEvicted(key, value, reason)
+		}
+	}
+}
+
+func (g *Group) enqueueL2(key string, value ByteView) {
+	q := g.l2Queue
+	q.mu.Lock()
+	if _, ok := q.pending[key]; !ok && len(q.pending) >= l2QueueSize {
+		q.mu.Unlock()
+		g.Stats.L2Drops.Add(1)
+		return
+	}
+	q.pending[key] = value
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// 在后台把队列中的值写进L2Cache，不持有缓存锁
+func (g *Group) writeL2() {
+	q := g.l2Queue
+	for range q.wake {
+		for {
+			q.writeMu.Lock()
+			key, value, ok := q.pop()
+			if !ok {
+				q.writeMu.Unlock()
+				break
+			}
+			if err := g.l2.Put(key, value.b, value.e); err != nil {
+				log.Println("[MikuCache] Failed to write to l2 cache", err)
+			}
+			q.writeMu.Unlock()
+		}
+	}
+}
+
+// 从L2Cache中查找key，命中时放回mainCache。还在队列中没写进去的值也算命中
+func (g *Group) lookupL2(key string) (ByteView, bool) {
+	if g.l2 == nil {
+		return ByteView{}, false
+	}
+	if value, ok := g.l2Queue.take(key); ok && !value.expired(time.Now()) {
+		g.Stats.L2Hits.Add(1)
+		g.populateCache(key, value)
+		return value, true
+	}
+	b, expire, ok := g.l2.Get(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	value := ByteView{b: b, e: expire}
+	if value.expired(time.Now()) {
+		return ByteView{}, false
+	}
+	g.Stats.L2Hits.Add(1)
+	g.populateCache(key, value)
+	return value, true
+}
+
+// 删除L2Cache中的key，删除和写入新值时都要调用，否则新值过期之后旧值又会被读出来
+func (g *Group) removeFromL2(key string) {
+	if g.l2 == nil {
+		return
+	}
+	q := g.l2Queue
+	q.writeMu.Lock()
+	defer q.writeMu.Unlock()
+	q.take(key)
+	if err := g.l2.Delete(key); err != nil {
+		log.Println("[MikuCache] Failed to delete from l2 cache", err)
+	}
+}
@@ -2,6 +2,7 @@ package lru
 
 import (
 	"container/list"
+	"time"
 )
 
 type Cache struct {
@@ -10,21 +11,47 @@ type Cache struct {
 	ll       *list.List
 	// 键是字符串，值是双向链表中对应节点的指针,list.Element就是entry结构体，entry表示一个节点，里面存储键值对
 	cache map[string]*list.Element
-	// 可选的，清除记录的时候调用
-	OnEvicted func(key string, value Value)
+	// 可选的，清除记录的时候调用，reason说明记录是因为什么被清除的
+	OnEvicted func(key string, value Value, reason EvictReason)
 }
 
 // 双向链表节点的数据类型,链表中存储的都是这些节点，cache 中存储的是节点的指针
 type entry struct {
-	key   string
-	value Value
+	key    string
+	value  Value
+	expire time.Time // 过期时间，零值表示永不过期
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
 }
 
 type Value interface {
 	Len() int
 }
 
-func New(maxBytes int64, onEnvicted func(string, Value)) *Cache {
+// EvictReason 表示记录被清除的原因
+type EvictReason int
+
+const (
+	EvictCapacity EvictReason = iota // 超过最大内存，被LRU淘汰
+	EvictExpired                     // 已经过期
+	EvictRemoved                     // 被调用方主动删除
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+func New(maxBytes int64, onEnvicted func(string, Value, EvictReason)) *Cache {
 	return &Cache{
 		maxBytes:  maxBytes,
 		ll:        list.New(),
@@ -34,7 +61,13 @@ func New(maxBytes int64, onEnvicted func(string, Value)) *Cache {
 	}
 }
 
+// 添加一条永不过期的记录
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// 添加一条记录，到了expire之后这条记录就不能再被Get到了，expire为零值表示永不过期
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
 		// 取出节点，更新值
@@ -42,11 +75,13 @@ func (c *Cache) Add(key string, value Value) {
 		// key存在但是value不一样，那就需要更新已经用了的内存
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
+		kv.expire = expire
 	} else {
 		// 如果不存在的话，lru算法就得把这个新节点加到头部了
 		node := &entry{
-			key:   key,
-			value: value,
+			key:    key,
+			value:  value,
+			expire: expire,
 		}
 		// PushFront会返回一个*list.Element 也就是会把*entry转换为*list.Element，存储在链表中
 		ele := c.ll.PushFront(node)
@@ -62,28 +97,82 @@ func (c *Cache) Add(key string, value Value) {
 }
 func (c *Cache) Get(key string) (Value, bool) {
 	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		// 惰性过期：读到过期的记录直接删除
+		if kv.expired(time.Now()) {
+			c.removeElement(ele, EvictExpired)
+			return nil, false
+		}
 		// 如果这个值存在的话，那我们就把它放在队列头部
 		c.ll.MoveToFront(ele)
-		kv := ele.Value.(*entry)
 		return kv.value, true
 	}
 	return nil, false
 }
+
 func (c *Cache) RemoveOldest() {
 	// 取链表尾部节点
 	ele := c.ll.Back()
 	if ele != nil {
-		// 把节点从链表中删除
-		kv := ele.Value.(*entry) // 从*list.Element转换为*entry,就可以提取key value，然后从cache 哈希表中删除key，和它对应的node指针，同时更新nbytes
-		delete(c.cache, kv.key)
-		c.ll.Remove(ele)
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+		c.removeElement(ele, EvictCapacity)
+	}
+}
+
+// 删除key对应的记录，返回记录是否存在
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele, EvictRemoved)
+		return true
+	}
+	return false
+}
+
+// 清除所有已经过期的记录，返回清除的数量
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele, EvictExpired)
+			n++
+		}
+		ele = prev
+	}
+	return n
+}
+
+func (c *Cache) removeElement(ele *list.Element, reason EvictReason) {
+	// 把节点从链表中删除
+	kv := ele.Value.(*entry) // 从*list.Element转换为*entry,就可以提取key value，然后从cache 哈希表中删除key，和它对应的node指针，同时更新nbytes
+	delete(c.cache, kv.key)
+	c.ll.Remove(ele)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value, reason)
+	}
+}
+
+// Range 从最久没有访问的记录开始遍历所有没有过期的记录，fn返回false时停止。
+// 按遍历的顺序重新Add可以得到同样的LRU顺序
+func (c *Cache) Range(fn func(key string, value Value, expire time.Time) bool) {
+	now := time.Now()
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*entry)
+		if kv.expired(now) {
+			continue
+		}
+		if !fn(kv.key, kv.value, kv.expire) {
+			return
 		}
 	}
 }
 
+// 返回已使用的内存
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
 // 返回链表节点数量
 func (c *Cache) Len() int {
 	return c.ll.Len()
@@ -1,7 +1,9 @@
 package lru
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 type String string
@@ -35,7 +37,7 @@ func TestGetMore(t *testing.T) {
 
 func TestOnEvicted(t *testing.T) {
 	keys := make([]string, 0)
-	callback := func(key string, value Value) {
+	callback := func(key string, value Value, reason EvictReason) {
 		keys = append(keys, key)
 	}
 	lru := New(10, callback)
@@ -49,3 +51,87 @@ func TestOnEvicted(t *testing.T) {
 	}
 	t.Log("keys:", keys)
 }
+
+func TestExpire(t *testing.T) {
+	reasons := make(map[string]EvictReason)
+	lru := New(0, func(key string, value Value, reason EvictReason) {
+		reasons[key] = reason
+	})
+	lru.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	lru.AddWithExpire("key2", String("1234"), time.Now().Add(time.Hour))
+	lru.Add("key3", String("1234"))
+	if _, ok := lru.Get("key1"); ok {
+		t.Fatalf("expired key1 should not be returned")
+	}
+	if reasons["key1"] != EvictExpired {
+		t.Fatalf("key1 evicted with %v, want %v", reasons["key1"], EvictExpired)
+	}
+	if _, ok := lru.Get("key2"); !ok {
+		t.Fatalf("cache hit key2 failed")
+	}
+	if lru.Len() != 2 {
+		t.Fatalf("lru len = %d, want 2", lru.Len())
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	var evicted []string
+	lru := New(0, func(key string, value Value, reason EvictReason) {
+		if reason == EvictExpired {
+			evicted = append(evicted, key)
+		}
+	})
+	past := time.Now().Add(-time.Second)
+	lru.AddWithExpire("key1", String("1"), past)
+	lru.Add("key2", String("2"))
+	lru.AddWithExpire("key3", String("3"), past)
+	if n := lru.RemoveExpired(); n != 2 || len(evicted) != 2 {
+		t.Fatalf("RemoveExpired = %d, evicted %v, want 2", n, evicted)
+	}
+	if lru.Len() != 1 {
+		t.Fatalf("lru len = %d, want 1", lru.Len())
+	}
+}
+
+func TestRemove(t *testing.T) {
+	var reason EvictReason
+	lru := New(0, func(key string, value Value, r EvictReason) {
+		reason = r
+	})
+	lru.Add("key1", String("1234"))
+	if !lru.Remove("key1") || reason != EvictRemoved {
+		t.Fatalf("remove key1 failed, reason = %v", reason)
+	}
+	if _, ok := lru.Get("key1"); ok {
+		t.Fatalf("removed key1 should not be returned")
+	}
+	if lru.Remove("key1") {
+		t.Fatalf("remove key1 twice should return false")
+	}
+}
+
+func TestRange(t *testing.T) {
+	lru := New(0, nil)
+	lru.Add("key1", String("1"))
+	lru.Add("key2", String("2"))
+	lru.AddWithExpire("key3", String("3"), time.Now().Add(-time.Second))
+	lru.Add("key4", String("4"))
+	lru.Get("key1")
+	var keys []string
+	lru.Range(func(key string, value Value, expire time.Time) bool {
+		keys = append(keys, key)
+		return true
+	})
+	// 从最久没有访问的开始，过期的记录被跳过
+	if want := "key2,key4,key1"; strings.Join(keys, ",") != want {
+		t.Fatalf("Range = %v, want %s", keys, want)
+	}
+	keys = keys[:0]
+	lru.Range(func(key string, value Value, expire time.Time) bool {
+		keys = append(keys, key)
+		return false
+	})
+	if len(keys) != 1 {
+		t.Fatalf("Range did not stop, visited %v", keys)
+	}
+}
@@ -0,0 +1,176 @@
+package geecache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 耗时直方图的桶上限，单位秒
+var latencyBuckets = [...]float64{0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// histogram 是按Prometheus的格式统计耗时的直方图，零值可以直接使用
+type histogram struct {
+	counts [len(latencyBuckets) + 1]atomic.Int64 // 每个桶各自的计数，最后一个是+Inf，输出时再累加
+	sum    atomic.Int64                          // 纳秒
+	count  atomic.Int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets[:], seconds)
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+	h.count.Add(1)
+}
+
+// peerStats 统计本节点作为客户端访问某个远程节点的情况
+type peerStats struct {
+	Requests AtomicInt
+	Errors   AtomicInt
+}
+
+func (s *peerStats) record(err error) {
+	s.Requests.Add(1)
+	if err != nil {
+		s.Errors.Add(1)
+	}
+}
+
+// peerStatser 由HTTPPool和GRPCPool实现，返回每个远程节点的客户端统计
+type peerStatser interface {
+	peerStats() map[string]*peerStats
+}
+
+// NewMetricsHandler 返回一个以Prometheus文本格式输出所有Group、缓存和节点客户端指标的handler，
+// 可以和HTTPPool挂在同一个端口上，比如 mux.Handle("/metrics", NewMetricsHandler(pool))
+func NewMetricsHandler(pickers ...PeerPicker) http.Handler {
+	return &metricsHandler{pickers: pickers}
+}
+
+type metricsHandler struct {
+	pickers []PeerPicker
+}
+
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	h.writeTo(w)
+}
+
+func (h *metricsHandler) writeTo(w io.Writer) {
+	mu.RLock()
+	gs := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		gs = append(gs, g)
+	}
+	mu.RUnlock()
+	sort.Slice(gs, func(i, j int) bool { return gs[i].name < gs[j].name })
+
+	counters := []struct {
+		name, help string
+		value      func(s *Stats) *AtomicInt
+	}{
+		{"geecache_gets_total", "Get requests, including requests from peers.", func(s *Stats) *AtomicInt { return &s.Gets }},
+		{"geecache_hits_total", "Get requests served from mainCache or hotCache.", func(s *Stats) *AtomicInt { return &s.CacheHits }},
+		{"geecache_peer_loads_total", "Values successfully loaded from peers.", func(s *Stats) *AtomicInt { return &s.PeerLoads }},
+		{"geecache_peer_errors_total", "Failed loads from peers.", func(s *Stats) *AtomicInt { return &s.PeerErrors }},
+		{"geecache_loads_total", "Get requests that missed the cache.", func(s *Stats) *AtomicInt { return &s.Loads }},
+		{"geecache_loads_deduped_total", "Loads left after singleflight deduplication.", func(s *Stats) *AtomicInt { return &s.LoadsDeduped }},
+		{"geecache_recheck_hits_total", "Loads that found the value in the cache after another load finished.", func(s *Stats) *AtomicInt { return &s.RecheckHits }},
+		{"geecache_local_loads_total", "Values successfully loaded by the Getter.", func(s *Stats) *AtomicInt { return &s.LocalLoads }},
+		{"geecache_local_load_errors_total", "Failed loads by the Getter.", func(s *Stats) *AtomicInt { return &s.LocalLoadErrs }},
+		{"geecache_server_requests_total", "Get requests received from peers.", func(s *Stats) *AtomicInt { return &s.ServerRequests }},
+		{"geecache_filter_rejects_total", "Get requests rejected by the key filter.", func(s *Stats) *AtomicInt { return &s.FilterRejects }},
+		{"geecache_l2_hits_total", "Loads served by the L2 cache.", func(s *Stats) *AtomicInt { return &s.L2Hits }},
+		{"geecache_l2_drops_total", "Evicted values dropped because the L2 write queue was full.", func(s *Stats) *AtomicInt { return &s.L2Drops }},
+		{"geecache_keys_handed_off_total", "Keys transferred to their new owner after a membership change or on shutdown.", func(s *Stats) *AtomicInt { return &s.KeysHandedOff }},
+	}
+	for _, c := range counters {
+		writeHeader(w, c.name, c.help, "counter")
+		for _, g := range gs {
+			fmt.Fprintf(w, "%s{group=%s} %d\n", c.name, quoteLabel(g.name), c.value(&g.Stats).Get())
+		}
+	}
+
+	cacheMetrics := []struct {
+		name, help, typ string
+		value           func(s CacheStats) int64
+	}{
+		{"geecache_cache_bytes", "Bytes used by the cache.", "gauge", func(s CacheStats) int64 { return s.Bytes }},
+		{"geecache_cache_items", "Items in the cache.", "gauge", func(s CacheStats) int64 { return s.Items }},
+		{"geecache_cache_gets_total", "Lookups in the cache.", "counter", func(s CacheStats) int64 { return s.Gets }},
+		{"geecache_cache_hits_total", "Lookups that hit the cache.", "counter", func(s CacheStats) int64 { return s.Hits }},
+		{"geecache_cache_evictions_total", "Items evicted by capacity or expiration.", "counter", func(s CacheStats) int64 { return s.Evictions }},
+	}
+	caches := []struct {
+		name  string
+		which CacheType
+	}{{"main", MainCache}, {"hot", HotCache}}
+	for _, m := range cacheMetrics {
+		writeHeader(w, m.name, m.help, m.typ)
+		for _, g := range gs {
+			for _, c := range caches {
+				fmt.Fprintf(w, "%s{group=%s,cache=%q} %d\n", m.name, quoteLabel(g.name), c.name, m.value(g.CacheStats(c.which)))
+			}
+		}
+	}
+
+	writeHeader(w, "geecache_local_load_duration_seconds", "Latency of loading values by the Getter.", "histogram")
+	for _, g := range gs {
+		writeHistogram(w, "geecache_local_load_duration_seconds", "group="+quoteLabel(g.name), &g.localLoadLatency)
+	}
+	writeHeader(w, "geecache_peer_load_duration_seconds", "Latency of loading values from peers.", "histogram")
+	for _, g := range gs {
+		writeHistogram(w, "geecache_peer_load_duration_seconds", "group="+quoteLabel(g.name), &g.peerLoadLatency)
+	}
+
+	stats := make(map[string]*peerStats)
+	for _, p := range h.pickers {
+		if ps, ok := p.(peerStatser); ok {
+			for peer, s := range ps.peerStats() {
+				stats[peer] = s
+			}
+		}
+	}
+	peers := make([]string, 0, len(stats))
+	for peer := range stats {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	writeHeader(w, "geecache_peer_client_requests_total", "Requests sent to each peer.", "counter")
+	for _, peer := range peers {
+		fmt.Fprintf(w, "geecache_peer_client_requests_total{peer=%s} %d\n", quoteLabel(peer), stats[peer].Requests.Get())
+	}
+	writeHeader(w, "geecache_peer_client_errors_total", "Failed requests sent to each peer.", "counter")
+	for _, peer := range peers {
+		fmt.Fprintf(w, "geecache_peer_client_errors_total{peer=%s} %d\n", quoteLabel(peer), stats[peer].Errors.Get())
+	}
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeHistogram(w io.Writer, name, labels string, h *histogram) {
+	var cumulative int64
+	for i, le := range latencyBuckets {
+		cumulative += h.counts[i].Load()
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	cumulative += h.counts[len(latencyBuckets)].Load()
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, cumulative)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(time.Duration(h.sum.Load()).Seconds(), 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count.Load())
+}
+
+// 按Prometheus的规则转义标签值：反斜杠、双引号和换行
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
@@ -0,0 +1,281 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mikucache/geecache/geecachepb"
+	"mikucache/geecache/singleflight"
+	"slices"
+	"sync"
+	"time"
+)
+
+// BatchGetter 由可以一次加载多个key的Getter实现，比如用一条 SELECT ... WHERE key IN (...) 查询。
+// GetMulti时本节点负责的、缓存中没有的key会一起交给它，返回的map中没有的key视为不存在
+type BatchGetter interface {
+	GetMulti(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+type BatchGetterFunc func(ctx context.Context, keys []string) (map[string][]byte, error)
+
+func (f BatchGetterFunc) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	return f(ctx, keys)
+}
+
+// 实现Getter接口，这样BatchGetterFunc也能直接传给NewGroup
+func (f BatchGetterFunc) Get(key string) ([]byte, error) {
+	values, err := f(context.Background(), []string{key})
+	if err != nil {
+		return nil, err
+	}
+	value, ok := values[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return value, nil
+}
+
+func (g *Group) GetMulti(keys []string) (map[string]ByteView, error) {
+	return g.GetMultiContext(context.Background(), keys)
+}
+
+// GetMultiContext 批量获取多个key：先查本地缓存，剩下的key按负责的节点分组，
+// 每个远程节点只发一次请求，本节点负责的key实现了BatchGetter时一次加载。
+// 返回的map只包含取到的key，不存在的key不在map中；其他失败的key的错误合并后返回，
+// 此时map中仍然是所有成功的key
+func (g *Group) GetMultiContext(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	views, errs := g.getMulti(ctx, keys)
+	values := make(map[string]ByteView, len(views))
+	var all []error
+	for _, key := range keys {
+		if err, ok := errs[key]; ok {
+			all = append(all, err)
+			delete(errs, key) // 重复的key只报告一次
+		} else if v, ok := views[key]; ok && !v.notFound {
+			values[key] = v
+		}
+	}
+	return values, errors.Join(all...)
+}
+
+// 返回的views中可能有不存在的key(notFound)，errs是加载失败的key
+func (g *Group) getMulti(ctx context.Context, keys []string) (map[string]ByteView, map[string]error) {
+	views := make(map[string]ByteView, len(keys))
+	errs := make(map[string]error)
+	var misses []string
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if key == "" {
+			errs[key] = fmt.Errorf("key is required")
+			continue
+		}
+		g.Stats.Gets.Add(1)
+		if v, ok := g.lookupCache(key); ok {
+			g.Stats.CacheHits.Add(1)
+			views[key] = v
+			continue
+		}
+		if g.filter != nil && !g.filter.Test(key) {
+			g.Stats.FilterRejects.Add(1)
+			views[key] = ByteView{notFound: true}
+			continue
+		}
+		g.Stats.Loads.Add(1)
+		misses = append(misses, key)
+	}
+	if len(misses) == 0 {
+		return views, errs
+	}
+
+	// 和Get共享singleflight：正在被其他Get加载的key等待那次加载的结果，剩下的key一起批量加载，
+	// 加载期间对这些key的Get也会等待批量加载的结果
+	for key, r := range g.loader.DoMulti(ctx, misses, g.loadBatch) {
+		switch {
+		case errors.Is(r.Err, ErrNotFound):
+			views[key] = ByteView{notFound: true}
+		case r.Err != nil:
+			errs[key] = r.Err
+		default:
+			views[key] = r.Val.(ByteView)
+		}
+	}
+	return views, errs
+}
+
+// 批量加载keys，每个key的处理和load中singleflight的fn一样：L2Cache、副本节点、远程节点、本地数据源，
+// 区别是同一个节点负责的key只发一次请求，Getter实现了BatchGetter时本节点负责的key只加载一次
+func (g *Group) loadBatch(ctx context.Context, keys []string) map[string]singleflight.Result {
+	results := make(map[string]singleflight.Result, len(keys))
+	var mu sync.Mutex
+	set := func(key string, value ByteView, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[key] = singleflight.Result{Val: value, Err: err}
+	}
+
+	// 按负责的节点分组，开启了复制时发给每个key的第一个副本节点
+	batches := make(map[PeerGetter][]string)
+	owners := make(map[string][]PeerGetter)
+	var local []string
+	for _, key := range keys {
+		// 可能刚好有另一次load结束并把值放进了缓存
+		if v, ok := g.lookupCache(key); ok {
+			g.Stats.RecheckHits.Add(1)
+			set(key, v, nil)
+			continue
+		}
+		g.Stats.LoadsDeduped.Add(1)
+		if v, ok := g.lookupL2(key); ok {
+			set(key, v, nil)
+			continue
+		}
+		if o := g.replicas(key); o != nil {
+			owners[key] = o
+			if o[0] != nil {
+				batches[o[0]] = append(batches[o[0]], key)
+				continue
+			}
+		} else if g.peers != nil {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				batches[peer] = append(batches[peer], key)
+				continue
+			}
+		}
+		local = append(local, key)
+	}
+
+	var wg sync.WaitGroup
+	for peer, batch := range batches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := g.getMultiFromPeer(ctx, peer, batch, set)
+			if err == nil {
+				return
+			}
+			g.Stats.PeerErrors.Add(1)
+			log.Println("[MikuCache] Failed to get multi from peer", err)
+			// 和load一样，先依次尝试其他副本节点，轮到自己或者都失败时从本地数据源加载
+			var rest []string
+			for _, key := range batch {
+				if o := owners[key]; o != nil {
+					if value, ok, err := g.loadFromReplicas(ctx, key, o[1:]); ok {
+						set(key, value, err)
+						continue
+					}
+				}
+				rest = append(rest, key)
+			}
+			g.getMultiLocally(ctx, rest, set)
+		}()
+	}
+	g.getMultiLocally(ctx, local, set)
+	wg.Wait()
+	return results
+}
+
+// 一次请求从peer获取batch中的所有key，请求本身失败时返回错误，单个key的结果通过set返回
+func (g *Group) getMultiFromPeer(ctx context.Context, peer PeerGetter, batch []string, set func(string, ByteView, error)) error {
+	req := &geecachepb.GetMultiRequest{Group: g.name, Keys: batch}
+	res := &geecachepb.GetMultiResponse{}
+	start := time.Now()
+	err := peer.GetMulti(ctx, req, res)
+	g.peerLoadLatency.observe(time.Since(start))
+	if err != nil {
+		return err
+	}
+	if len(res.GetValues()) != len(batch) {
+		return fmt.Errorf("peer returned %d values for %d keys", len(res.GetValues()), len(batch))
+	}
+	for i, key := range batch {
+		if i < len(res.GetErrors()) && res.GetErrors()[i] != "" {
+			set(key, ByteView{}, fmt.Errorf("%s: %s", key, res.GetErrors()[i]))
+			continue
+		}
+		g.Stats.PeerLoads.Add(1)
+		value := viewFromResponse(res.GetValues()[i])
+		if !value.notFound {
+			// 和loadFromReplicas一样，自己是副本节点时放进mainCache
+			if slices.Contains(g.replicas(key), nil) {
+				g.populateCache(key, value)
+			} else {
+				g.maybePopulateHot(key, value)
+			}
+		}
+		set(key, value, nil)
+	}
+	return nil
+}
+
+// 从本地数据源加载keys，Getter实现了BatchGetter时只调用一次，否则逐个并发加载。
+// keys已经由loadBatch占住了singleflight，这里不能再通过g.loader加载
+func (g *Group) getMultiLocally(ctx context.Context, keys []string, set func(string, ByteView, error)) {
+	if len(keys) == 0 {
+		return
+	}
+	bg, ok := g.getter.(BatchGetter)
+	if !ok {
+		var wg sync.WaitGroup
+		for _, key := range keys {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				start := time.Now()
+				value, err := g.getLocally(ctx, key)
+				g.localLoadLatency.observe(time.Since(start))
+				g.recordLocalLoad(err)
+				set(key, value, err)
+			}()
+		}
+		wg.Wait()
+		return
+	}
+
+	start := time.Now()
+	values, err := bg.GetMulti(ctx, keys)
+	g.localLoadLatency.observe(time.Since(start))
+	if err != nil {
+		g.Stats.LocalLoadErrs.Add(int64(len(keys)))
+		for _, key := range keys {
+			set(key, ByteView{}, err)
+		}
+		return
+	}
+	for _, key := range keys {
+		bytes, ok := values[key]
+		if !ok {
+			// 返回的map中没有的key不存在，不算加载失败
+			g.populateNotFound(key)
+			set(key, ByteView{notFound: true}, nil)
+			continue
+		}
+		g.Stats.LocalLoads.Add(1)
+		value := g.populateLocal(key, bytes, g.ttl)
+		g.pushToReplicasAsync(ctx, key, value)
+		set(key, value, nil)
+	}
+}
+
+// 处理其他节点发来的批量请求，结果和in.Keys一一对应
+func (g *Group) getMultiForPeer(ctx context.Context, in *geecachepb.GetMultiRequest) *geecachepb.GetMultiResponse {
+	g.Stats.ServerRequests.Add(1)
+	views, errs := g.getMulti(ctx, in.GetKeys())
+	res := &geecachepb.GetMultiResponse{
+		Values: make([]*geecachepb.Response, len(in.GetKeys())),
+		Errors: make([]string, len(in.GetKeys())),
+	}
+	for i, key := range in.GetKeys() {
+		if err, ok := errs[key]; ok {
+			res.Values[i] = &geecachepb.Response{}
+			res.Errors[i] = err.Error()
+			continue
+		}
+		res.Values[i] = newResponse(views[key])
+	}
+	return res
+}
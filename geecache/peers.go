@@ -1,6 +1,13 @@
 package geecache
 
-import "mikucache/geecache/geecachepb"
+import (
+	"context"
+	"fmt"
+	"mikucache/geecache/geecachepb"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type PeerPicker interface {
 	// 用于根据传入的key 选择相应的PeerGetter
@@ -10,4 +17,75 @@ type PeerPicker interface {
 type PeerGetter interface {
 	// 用于从对应group 查找缓存值 对应于HTTP客户端
 	Get(in *geecachepb.Request, out *geecachepb.Response) error
+	// 和Get一样，ctx被取消或超时时放弃请求
+	GetContext(ctx context.Context, in *geecachepb.Request, out *geecachepb.Response) error
+	// 通知远程节点删除缓存值
+	Delete(ctx context.Context, in *geecachepb.DeleteRequest) error
+	// 把缓存值写到远程节点
+	Set(ctx context.Context, in *geecachepb.SetRequest) error
+	// 一次请求获取多个key，out.Values和in.Keys一一对应
+	GetMulti(ctx context.Context, in *geecachepb.GetMultiRequest, out *geecachepb.GetMultiResponse) error
+}
+
+// PeerLister 由能列出所有远程节点的PeerPicker实现，用来广播缓存失效
+type PeerLister interface {
+	// 返回除自己以外的所有节点
+	AllPeers() []PeerGetter
+}
+
+// ReplicaPicker 由支持多副本的PeerPicker实现，每个key存放在哈希环上连续的几个节点上
+type ReplicaPicker interface {
+	// 按哈希环上的顺序返回负责key的所有节点，第一个是主节点，自己用nil表示
+	PickReplicas(key string) []PeerGetter
+}
+
+// ParsePeerSpec 解析节点描述，格式是 "地址" 或者 "地址 权重"，权重缺省为1。
+// 权重越大的节点在哈希环上的虚拟节点越多，负责的key也越多，适合机器配置不同的集群
+func ParsePeerSpec(spec string) (addr string, weight int, err error) {
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 1:
+		return fields[0], 1, nil
+	case 2:
+		weight, err = strconv.Atoi(fields[1])
+		if err != nil || weight < 1 {
+			return "", 0, fmt.Errorf("invalid weight in peer spec %q", spec)
+		}
+		return fields[0], weight, nil
+	default:
+		return "", 0, fmt.Errorf("invalid peer spec %q", spec)
+	}
+}
+
+// 解析RemovePeer的节点描述，没有写权重时weight为0，表示不管节点的权重是多少都删除
+func parseRemoveSpec(spec string) (addr string, weight int, err error) {
+	addr, weight, err = ParsePeerSpec(spec)
+	if err == nil && len(strings.Fields(spec)) == 1 {
+		weight = 0
+	}
+	return addr, weight, err
+}
+
+// 把缓存值转换为发给其他节点的响应，过期时间用unix纳秒表示
+func newResponse(view ByteView) *geecachepb.Response {
+	return &geecachepb.Response{Value: view.ByteSlice(), Expire: expireToProto(view.e), NotFound: view.notFound}
+}
+
+func expireToProto(e time.Time) int64 {
+	if e.IsZero() {
+		return 0
+	}
+	return e.UnixNano()
+}
+
+func expireFromProto(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// 从其他节点的响应中还原缓存值
+func viewFromResponse(res *geecachepb.Response) ByteView {
+	return ByteView{b: res.GetValue(), e: expireFromProto(res.GetExpire()), notFound: res.GetNotFound()}
 }
@@ -0,0 +1,245 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"mikucache/geecache/geecachepb"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// 节点列表通常是一批一批变化的，等这么久再开始转移，避免中间状态下把key发错节点
+	rebalanceDelay = time.Second
+	// 每次Transfer请求最多携带的字节数
+	transferBatchBytes = 256 << 10
+)
+
+// Transferrer 由支持批量转移缓存值的PeerGetter实现，没有实现时逐个调用Set
+type Transferrer interface {
+	Transfer(ctx context.Context, in *geecachepb.TransferRequest) error
+}
+
+// rebalancer 在哈希环变化之后，把使用picker的每个Group中不再由自己负责的key转移给新的负责节点
+type rebalancer struct {
+	picker      PeerPicker
+	topN        int   // 每个Group最多转移多少个key，按最近访问从新到旧，<=0表示不限制
+	bytesPerSec int64 // 转移的带宽上限，<=0表示不限制
+	trigger     chan struct{}
+	// stop之后关闭trigger并取消正在进行的转移
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	closed bool
+}
+
+func newRebalancer(picker PeerPicker, topN int, bytesPerSec int64) *rebalancer {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &rebalancer{
+		picker:      picker,
+		topN:        topN,
+		bytesPerSec: bytesPerSec,
+		trigger:     make(chan struct{}, 1),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	go r.loop()
+	return r
+}
+
+// 通知哈希环发生了变化，不会阻塞，连续的多次通知会被合并。r为nil或者已经stop时什么也不做
+func (r *rebalancer) notify() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// 停止后台转移，节点关闭时调用，可以调用多次。之后手动调用run仍然可以转移
+func (r *rebalancer) stop() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	close(r.trigger)
+	r.cancel()
+}
+
+func (r *rebalancer) loop() {
+	for range r.trigger {
+		if !sleepContext(r.ctx, rebalanceDelay) {
+			return
+		}
+		if err := r.run(r.ctx); err != nil && r.ctx.Err() == nil {
+			log.Println("[MikuCache] Failed to rebalance", err)
+		}
+	}
+}
+
+// 转移所有Group的key，所有Group共用一个带宽上限
+func (r *rebalancer) run(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	limiter := newRateLimiter(r.bytesPerSec)
+	var errs []error
+	for _, g := range groupsUsing(r.picker) {
+		errs = append(errs, g.handOff(ctx, r.topN, limiter, true))
+	}
+	return errors.Join(errs...)
+}
+
+// 注册了picker的所有Group
+func groupsUsing(picker PeerPicker) []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	var gs []*Group
+	for _, g := range groups {
+		if g.peers == picker {
+			gs = append(gs, g)
+		}
+	}
+	return gs
+}
+
+// 把mainCache中不再由自己负责的key按最近访问从新到旧取前n个（n<=0表示全部），
+// 以副本的方式发给现在负责它们的节点。remove为true时发送成功的key从mainCache中删除
+func (g *Group) handOff(ctx context.Context, n int, limiter *rateLimiter, remove bool) error {
+	if g.peers == nil {
+		return nil
+	}
+	moved := g.movedEntries(n)
+	var errs []error
+	for peer, entries := range moved {
+		sent, err := g.transfer(ctx, peer, entries, limiter)
+		g.Stats.KeysHandedOff.Add(int64(sent))
+		if remove {
+			for _, e := range entries[:sent] {
+				g.mainCache.remove(e.key)
+			}
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 按新的负责节点分组，每组内部保持从新到旧的顺序
+func (g *Group) movedEntries(n int) map[PeerGetter][]cacheEntry {
+	entries, ok := g.mainCache.entries()
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	moved := make(map[PeerGetter][]cacheEntry)
+	count := 0
+	// entries按淘汰的先后顺序排列，越靠后越热
+	for i := len(entries) - 1; i >= 0 && (n <= 0 || count < n); i-- {
+		e := entries[i]
+		if e.value.notFound || e.value.expired(now) {
+			continue
+		}
+		if owners := g.replicas(e.key); owners != nil {
+			// 开启了复制时，自己还是副本节点之一就不需要转移
+			if slices.Contains(owners, nil) {
+				continue
+			}
+			moved[owners[0]] = append(moved[owners[0]], e)
+			count++
+			continue
+		}
+		if peer, ok := g.peers.PickPeer(e.key); ok {
+			moved[peer] = append(moved[peer], e)
+			count++
+		}
+	}
+	return moved
+}
+
+// 分批把entries发给peer，返回发送成功的数量，entries[:sent]都已经发送成功
+func (g *Group) transfer(ctx context.Context, peer PeerGetter, entries []cacheEntry, limiter *rateLimiter) (sent int, err error) {
+	t, batched := peer.(Transferrer)
+	for sent < len(entries) {
+		in := &geecachepb.TransferRequest{Group: g.name}
+		size := 0
+		for _, e := range entries[sent:] {
+			n := len(e.key) + e.value.Len()
+			if len(in.Entries) > 0 && size+n > transferBatchBytes {
+				break
+			}
+			in.Entries = append(in.Entries, &geecachepb.SetRequest{
+				Group:   g.name,
+				Key:     e.key,
+				Value:   e.value.b,
+				Expire:  expireToProto(e.value.e),
+				Replica: true,
+			})
+			size += n
+		}
+		if !limiter.wait(ctx, size) {
+			return sent, ctx.Err()
+		}
+		if batched {
+			err = t.Transfer(ctx, in)
+		} else {
+			for _, set := range in.Entries {
+				if err = peer.Set(ctx, set); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return sent, err
+		}
+		sent += len(in.Entries)
+	}
+	return sent, nil
+}
+
+// 处理其他节点转移过来的key
+func (g *Group) receiveTransfer(in *geecachepb.TransferRequest) {
+	for _, e := range in.GetEntries() {
+		g.populateReplica(e.GetKey(), ByteView{b: cloneBytes(e.GetValue()), e: expireFromProto(e.GetExpire())})
+	}
+}
+
+// rateLimiter 按每秒字节数限速，为nil或者bytesPerSec<=0时不限制
+type rateLimiter struct {
+	bytesPerSec int64
+	start       time.Time
+	sent        int64
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &rateLimiter{bytesPerSec: bytesPerSec, start: time.Now()}
+}
+
+// 发送n字节之前调用，等到平均速度不超过上限，ctx结束时返回false
+func (l *rateLimiter) wait(ctx context.Context, n int) bool {
+	if l == nil {
+		return ctx.Err() == nil
+	}
+	l.sent += int64(n)
+	due := l.start.Add(time.Duration(float64(l.sent) / float64(l.bytesPerSec) * float64(time.Second)))
+	return sleepContext(ctx, time.Until(due))
+}
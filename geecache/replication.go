@@ -0,0 +1,111 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"mikucache/geecache/geecachepb"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 开启了复制时按哈希环上的顺序返回负责key的所有节点（自己用nil表示），否则返回nil
+func (g *Group) replicas(key string) []PeerGetter {
+	rp, ok := g.peers.(ReplicaPicker)
+	if !ok {
+		return nil
+	}
+	if owners := rp.PickReplicas(key); len(owners) > 1 {
+		return owners
+	}
+	return nil
+}
+
+// 依次请求负责key的节点，前面的节点失败时尝试下一个，轮到自己或者都失败时返回ok=false，
+// 由调用方从数据源加载。自己是副本节点时取回的值放进mainCache，否则按概率放进hotCache
+func (g *Group) loadFromReplicas(ctx context.Context, key string, owners []PeerGetter) (value ByteView, ok bool, err error) {
+	isOwner := slices.Contains(owners, nil)
+	for _, peer := range owners {
+		if peer == nil {
+			return ByteView{}, false, nil
+		}
+		start := time.Now()
+		value, err = g.fetchFromPeer(ctx, peer, key)
+		g.peerLoadLatency.observe(time.Since(start))
+		if err == nil || errors.Is(err, ErrNotFound) {
+			g.Stats.PeerLoads.Add(1)
+			if err == nil && isOwner {
+				g.populateCache(key, value)
+			} else if err == nil {
+				g.maybePopulateHot(key, value)
+			}
+			return value, true, err
+		}
+		g.Stats.PeerErrors.Add(1)
+		log.Println("[MikuCache] Failed to get from replica", err)
+	}
+	return ByteView{}, false, nil
+}
+
+// 自己是key的副本节点之一时，把从数据源加载或写入的值推送给其他副本节点
+func (g *Group) pushToReplicas(ctx context.Context, key string, value ByteView) error {
+	if g.peers == nil {
+		return nil
+	}
+	owners := g.replicas(key)
+	if !slices.Contains(owners, nil) {
+		return nil
+	}
+	req := &geecachepb.SetRequest{
+		Group:   g.name,
+		Key:     key,
+		Value:   value.b,
+		Expire:  expireToProto(value.e),
+		Replica: true,
+	}
+	return eachPeer(owners, func(peer PeerGetter) error {
+		return peer.Set(ctx, req)
+	})
+}
+
+// 从数据源加载之后在后台推送副本，不让每次未命中都等最慢的副本节点。
+// 推送失败只是副本节点少了这个值，之后它会自己加载
+func (g *Group) pushToReplicasAsync(ctx context.Context, key string, value ByteView) {
+	if g.peers == nil {
+		return
+	}
+	// 加载完成后调用方的ctx可能马上被取消，推送不受它影响
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := g.pushToReplicas(ctx, key, value); err != nil {
+			log.Println("[MikuCache] Failed to push to replicas", err)
+		}
+	}()
+}
+
+// 通知负责key的所有远程节点删除它
+func (g *Group) removeFromReplicas(ctx context.Context, key string, owners []PeerGetter) error {
+	req := &geecachepb.DeleteRequest{Group: g.name, Key: key}
+	return eachPeer(owners, func(peer PeerGetter) error {
+		return peer.Delete(ctx, req)
+	})
+}
+
+// 并发地对每个远程节点调用fn，跳过表示自己的nil
+func eachPeer(peers []PeerGetter, fn func(peer PeerGetter) error) error {
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		if peer == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(peer)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
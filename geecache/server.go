@@ -0,0 +1,115 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Server 是使用HTTPPool的缓存节点，和http.ListenAndServe的区别是可以优雅地关闭，
+// Shutdown时其他节点会把它从哈希环上删除，正在处理的请求和正在进行的加载都会完成
+type Server struct {
+	pool *HTTPPool
+	srv  *http.Server
+	// Shutdown时交给新的负责节点的热点key数量，0表示不交接
+	handoff int
+}
+
+// ServerOption 用来配置 Server
+type ServerOption func(*Server)
+
+// WithHandler 设置处理请求的handler，默认只处理节点之间的请求，
+// 需要同时提供其他接口（比如/metrics）时传入包含pool的http.ServeMux
+func WithHandler(h http.Handler) ServerOption {
+	return func(s *Server) {
+		s.srv.Handler = h
+	}
+}
+
+// WithHandoff 设置Shutdown时每个Group把mainCache中最热的n个key推送给它们新的负责节点，
+// 这些key在新节点上不需要重新从数据源加载
+func WithHandoff(n int) ServerOption {
+	return func(s *Server) {
+		s.handoff = n
+	}
+}
+
+func NewServer(pool *HTTPPool, opts ...ServerOption) *Server {
+	s := &Server{
+		pool: pool,
+		srv:  &http.Server{Handler: pool},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ListenAndServe 监听addr，addr可以带http://或https://前缀。Shutdown之后返回http.ErrServerClosed
+func (s *Server) ListenAndServe(addr string) error {
+	addr = strings.TrimPrefix(strings.TrimPrefix(addr, "http://"), "https://")
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(lis)
+}
+
+// Serve 在lis上处理请求，HTTPPool设置了WithTLSConfig时使用HTTPS
+func (s *Server) Serve(lis net.Listener) error {
+	if s.pool.tlsConfig != nil {
+		s.srv.TLSConfig = s.pool.tlsConfig.Clone()
+		return s.srv.ServeTLS(lis, "", "")
+	}
+	return s.srv.Serve(lis)
+}
+
+// Shutdown 优雅地关闭节点：
+//  1. 通知其他所有节点把自己从哈希环上删除，之后的请求不会再发到这里；
+//  2. 配置了WithHandoff时，把热点key推送给它们新的负责节点；
+//  3. 停止接受新的连接，等待正在处理的请求结束；
+//  4. 等待正在进行的加载（包括singleflight合并的调用）结束。
+//
+// 开始之前先停止WithRebalance的后台转移。
+// ctx结束时不再等待，返回ctx.Err()。通知和交接失败只会记录日志，不影响关闭
+func (s *Server) Shutdown(ctx context.Context) error {
+	// 之后的哈希环变化不再转移key，要转移的热点key由下面的handOff发送
+	s.pool.rebalancer.stop()
+	s.leave(ctx)
+	// 自己也不再负责任何key，之后本地的Get都会转发给新的负责节点
+	s.pool.removeNode(s.pool.self)
+	groups := groupsUsing(s.pool)
+	if s.handoff > 0 {
+		for _, g := range groups {
+			// 保留mainCache中的值，退出前还可能要保存快照
+			if err := g.handOff(ctx, s.handoff, nil, false); err != nil {
+				log.Println("[MikuCache] Failed to hand off hot keys", err)
+			}
+		}
+	}
+	err := s.srv.Shutdown(ctx)
+	for _, g := range groups {
+		err = errors.Join(err, g.loader.Wait(ctx))
+	}
+	return err
+}
+
+// 通知其他所有节点自己将要离开
+func (s *Server) leave(ctx context.Context) {
+	s.pool.mu.Lock()
+	getters := make(map[string]*httpGetter, len(s.pool.httpGetters))
+	for peer, getter := range s.pool.httpGetters {
+		if peer != s.pool.self {
+			getters[peer] = getter
+		}
+	}
+	s.pool.mu.Unlock()
+	for peer, getter := range getters {
+		if err := getter.leave(ctx, s.pool.self); err != nil {
+			s.pool.Log("Failed to announce leave to %s: %v", peer, err)
+		}
+	}
+}
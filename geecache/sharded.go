@@ -0,0 +1,82 @@
+package geecache
+
+import (
+	"mikucache/geecache/eviction"
+	"mikucache/geecache/lru"
+)
+
+// shardedCache 按key的哈希把记录分到多个独立加锁的cache上，
+// 不同分片上的读写互不影响。cache的get要调整LRU链表，也得加互斥锁，只有一把锁时多核下会成为瓶颈
+type shardedCache struct {
+	shards []*cache
+}
+
+func newShardedCache(cacheBytes int64, n int, newPolicy eviction.Factory, onEvicted func(string, ByteView, lru.EvictReason)) *shardedCache {
+	// 内存上限平均分给每个分片，cacheBytes为0表示不限制
+	shardBytes := cacheBytes / int64(n)
+	if cacheBytes > 0 && shardBytes == 0 {
+		shardBytes = 1
+	}
+	s := &shardedCache{shards: make([]*cache, n)}
+	for i := range s.shards {
+		s.shards[i] = &cache{cacheBytes: shardBytes, newPolicy: newPolicy, onEvicted: onEvicted}
+	}
+	return s
+}
+
+func (s *shardedCache) shard(key string) *cache {
+	// FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return s.shards[h%uint32(len(s.shards))]
+}
+
+func (s *shardedCache) add(key string, value ByteView) {
+	s.shard(key).add(key, value)
+}
+
+func (s *shardedCache) get(key string) (ByteView, bool) {
+	return s.shard(key).get(key)
+}
+
+func (s *shardedCache) remove(key string) {
+	s.shard(key).remove(key)
+}
+
+func (s *shardedCache) removeExpired() int {
+	n := 0
+	for _, c := range s.shards {
+		n += c.removeExpired()
+	}
+	return n
+}
+
+// 依次返回每个分片的记录，每个分片内部保持淘汰顺序
+func (s *shardedCache) entries() ([]cacheEntry, bool) {
+	var all []cacheEntry
+	for _, c := range s.shards {
+		entries, ok := c.entries()
+		if !ok {
+			return nil, false
+		}
+		all = append(all, entries...)
+	}
+	return all, true
+}
+
+// 所有分片的统计数据之和
+func (s *shardedCache) stats() CacheStats {
+	var total CacheStats
+	for _, c := range s.shards {
+		st := c.stats()
+		total.Bytes += st.Bytes
+		total.Items += st.Items
+		total.Gets += st.Gets
+		total.Hits += st.Hits
+		total.Evictions += st.Evictions
+	}
+	return total
+}
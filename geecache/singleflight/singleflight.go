@@ -1,20 +1,28 @@
 package singleflight
 
 import (
+	"context"
 	"sync"
 )
 
 // 代表正在进行中，或者已经结束的请求，使用sync.WaitGroup锁避免重入
 type call struct {
-	wg  sync.WaitGroup
-	val any
-	err error
+	wg   sync.WaitGroup
+	done chan struct{} // 请求结束时关闭，DoContext用它和ctx.Done()一起select
+	val  any
+	err  error
+	// 以下字段只有DoContext发起的请求才会用到，由Group.mu保护
+	waiters int                // 还在等待结果的调用方数量
+	cancel  context.CancelFunc // 所有调用方都放弃等待时取消fn
 }
 
 // Group是singleflight的主数据结构，管理不同key的请求(call)
 type Group struct {
 	mu sync.Mutex
 	m  map[string]*call
+	// 正在执行的fn的数量，包括所有调用方都已经放弃、但fn还没有返回的
+	running int
+	idle    []chan struct{} // Wait的调用方，running变为0时关闭
 }
 
 func NewGroup() *Group {
@@ -32,21 +40,193 @@ func (g *Group) Do(key string, fn func() (any, error)) (any, error) {
 		g.m = make(map[string]*call)
 	}
 	if c, ok := g.m[key]; ok {
+		// Do没有ctx，会一直等到结果，所以不能让DoContext的调用方把fn取消掉
+		c.waiters++
 		g.mu.Unlock()
 		c.wg.Wait()
 		return c.val, c.err
 	}
-	c := new(call)
-	c.wg.Add(1)
+	c := newCall()
 	g.m[key] = c
+	g.running++
 	g.mu.Unlock()
 
 	c.val, c.err = fn()
-	c.wg.Done()
+	c.finish()
 
 	g.mu.Lock()
 	delete(g.m, key)
+	g.done()
 	g.mu.Unlock()
 
 	return c.val, c.err
 }
+
+/*
+DoContext 和 Do 一样合并相同 key 的并发调用，区别在于：
+ 1. 调用方的 ctx 被取消时立即返回 ctx.Err()，不会影响其他调用方继续等待结果；
+ 2. fn 在单独的 goroutine 中执行，拿到的 ctx 保留了第一个调用方 ctx 中的值（比如 trace 信息），
+    但不会因为某一个调用方取消而取消，只有当所有调用方都放弃等待时才会被取消。
+*/
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (any, error)) (any, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	c, ok := g.m[key]
+	if !ok {
+		c = newCall()
+		fnCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c.cancel = cancel
+		g.m[key] = c
+		g.running++
+		go func() {
+			val, err := fn(fnCtx)
+			cancel()
+			g.mu.Lock()
+			c.val, c.err = val, err
+			if g.m[key] == c {
+				delete(g.m, key)
+			}
+			g.done()
+			g.mu.Unlock()
+			c.finish()
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		// 最后一个调用方也放弃了，取消fn，并让后来的调用方重新发起请求
+		if c.waiters == 0 && c.cancel != nil {
+			c.cancel()
+			if g.m[key] == c {
+				delete(g.m, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Result 是DoMulti中一个key的结果
+type Result struct {
+	Val any
+	Err error
+}
+
+/*
+DoMulti 一次处理多个 key：已经有调用在进行中的 key 等待那次调用的结果，
+其余的 key 交给同一次 fn 调用，fn 返回之前其他调用方对这些 key 的 Do/DoContext 也会等待它的结果。
+fn 需要返回每个传入的 key 的结果，在单独的 goroutine 中执行，因为被多个 key 共享，不会被取消。
+ctx 被取消时还没有结果的 key 返回 ctx.Err()
+*/
+func (g *Group) DoMulti(ctx context.Context, keys []string, fn func(ctx context.Context, keys []string) map[string]Result) map[string]Result {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	calls := make(map[string]*call, len(keys))
+	var own []string
+	for _, key := range keys {
+		if _, ok := calls[key]; ok {
+			continue
+		}
+		c, ok := g.m[key]
+		if !ok {
+			c = newCall()
+			g.m[key] = c
+			g.running++
+			own = append(own, key)
+		}
+		c.waiters++
+		calls[key] = c
+	}
+	g.mu.Unlock()
+
+	if len(own) > 0 {
+		go func() {
+			results := fn(context.WithoutCancel(ctx), own)
+			g.mu.Lock()
+			for _, key := range own {
+				c := calls[key]
+				c.val, c.err = results[key].Val, results[key].Err
+				if g.m[key] == c {
+					delete(g.m, key)
+				}
+				g.done()
+			}
+			g.mu.Unlock()
+			for _, key := range own {
+				calls[key].finish()
+			}
+		}()
+	}
+
+	results := make(map[string]Result, len(calls))
+	for key, c := range calls {
+		select {
+		case <-c.done:
+			results[key] = Result{Val: c.val, Err: c.err}
+		case <-ctx.Done():
+			g.mu.Lock()
+			c.waiters--
+			// 和DoContext一样，最后一个调用方放弃时取消单独发起的fn
+			if c.waiters == 0 && c.cancel != nil {
+				c.cancel()
+				if g.m[key] == c {
+					delete(g.m, key)
+				}
+			}
+			g.mu.Unlock()
+			results[key] = Result{Err: ctx.Err()}
+		}
+	}
+	return results
+}
+
+// Wait 等待所有正在执行的fn返回，ctx先结束时返回ctx.Err()。
+// 用于关闭服务前等待进行中的加载完成，Wait期间新发起的调用也会被等待
+func (g *Group) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	if g.running == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	g.idle = append(g.idle, ch)
+	g.mu.Unlock()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fn返回之后调用，需要持有g.mu
+func (g *Group) done() {
+	g.running--
+	if g.running == 0 {
+		for _, ch := range g.idle {
+			close(ch)
+		}
+		g.idle = nil
+	}
+}
+
+func newCall() *call {
+	c := &call{done: make(chan struct{})}
+	c.wg.Add(1)
+	return c
+}
+
+func (c *call) finish() {
+	close(c.done)
+	c.wg.Done()
+}
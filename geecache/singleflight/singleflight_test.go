@@ -1,9 +1,11 @@
 package singleflight
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestDo(t *testing.T) {
@@ -37,3 +39,128 @@ func TestDo(t *testing.T) {
 		t.Errorf("count = %v, want 1", count)
 	}
 }
+
+func TestDoContextCancel(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (any, error) {
+		select {
+		case <-release:
+			return "bar", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// 第一个调用方取消后，第二个调用方仍然能拿到结果
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := g.DoContext(ctx1, "Tom", fn)
+		errc <- err
+	}()
+	resc := make(chan any, 1)
+	go func() {
+		v, _ := g.DoContext(context.Background(), "Tom", fn)
+		resc <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel1()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("canceled caller got %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if v := <-resc; v != "bar" {
+		t.Fatalf("DoContext v = %v, want bar", v)
+	}
+
+	// 所有调用方都取消后，fn拿到的ctx也会被取消
+	fnCanceled := make(chan struct{})
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	go g.DoContext(ctx2, "Jack", func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		close(fnCanceled)
+		return nil, ctx.Err()
+	})
+	time.Sleep(10 * time.Millisecond)
+	cancel2()
+	select {
+	case <-fnCanceled:
+	case <-time.After(time.Second):
+		t.Fatal("fn was not canceled after every caller gave up")
+	}
+}
+
+func TestWait(t *testing.T) {
+	var g Group
+	if err := g.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait on idle group = %v", err)
+	}
+	release := make(chan struct{})
+	go g.DoContext(context.Background(), "Tom", func(ctx context.Context) (any, error) {
+		<-release
+		return "bar", nil
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	// fn还没有返回，Wait一直等到超时
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := g.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Wait = %v, want %v", err, context.DeadlineExceeded)
+	}
+	waited := make(chan error, 1)
+	go func() { waited <- g.Wait(context.Background()) }()
+	close(release)
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Fatalf("Wait = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after fn finished")
+	}
+}
+
+func TestDoMulti(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	// Tom已经在加载中
+	go g.DoContext(context.Background(), "Tom", func(ctx context.Context) (any, error) {
+		<-release
+		return "tom", nil
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	var batched []string
+	started := make(chan struct{})
+	done := make(chan map[string]Result, 1)
+	go func() {
+		done <- g.DoMulti(context.Background(), []string{"Tom", "Jack", "Jack"}, func(ctx context.Context, keys []string) map[string]Result {
+			batched = keys
+			close(started)
+			<-release
+			return map[string]Result{"Jack": {Val: "jack"}}
+		})
+	}()
+	<-started
+	// 批量加载期间Jack的其他调用等待它的结果
+	jack := make(chan any, 1)
+	go func() {
+		v, _ := g.Do("Jack", func() (any, error) { return "again", nil })
+		jack <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	results := <-done
+	if fmt.Sprint(batched) != "[Jack]" {
+		t.Fatalf("batched keys = %v, want [Jack]", batched)
+	}
+	if results["Tom"].Val != "tom" || results["Jack"].Val != "jack" || len(results) != 2 {
+		t.Fatalf("results = %v", results)
+	}
+	if v := <-jack; v != "jack" {
+		t.Fatalf("concurrent Do = %v, want the batch result", v)
+	}
+}
@@ -0,0 +1,277 @@
+package geecache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 快照格式（整数都是varint编码）：
+//
+//	magic "MIKUSNAP" | 版本(1字节) | group名 |
+//	记录... | 结束标记(1字节) | 记录数 | 以上所有字节的crc32(4字节大端)
+//
+// 每条记录是 类型(1字节) | key | value(只有recordValue有) | 过期时间(unix纳秒，0表示永不过期)，
+// key、value和group名都是 长度 | 字节。记录按淘汰的先后顺序排列，Restore按顺序添加后LRU顺序不变
+const (
+	snapshotMagic   = "MIKUSNAP"
+	snapshotVersion = 1
+
+	recordEnd      = 0
+	recordValue    = 1
+	recordNotFound = 2 // WithNegativeTTL缓存的不存在的key
+
+	// 单个字段的长度上限，超过说明文件已经损坏，避免按错误的长度分配内存
+	maxSnapshotField = 1 << 30
+)
+
+// ErrBadSnapshot 表示快照文件已经损坏，或者不是快照文件
+var ErrBadSnapshot = errors.New("geecache: bad snapshot")
+
+// WithSnapshot 在NewGroup时从path恢复mainCache，之后每隔interval把mainCache保存到path，
+// interval为0时只恢复不定期保存，可以在进程退出前调用SnapshotFile
+func WithSnapshot(path string, interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.snapshotPath = path
+		g.snapshotInterval = interval
+	}
+}
+
+// Snapshot 把mainCache中没有过期的记录写到w，hotCache中其他节点负责的key不会保存。
+// 淘汰策略需要实现eviction.Ranger，内置的策略都实现了
+func (g *Group) Snapshot(w io.Writer) error {
+	entries, ok := g.mainCache.entries()
+	if !ok {
+		return fmt.Errorf("geecache: eviction policy of group %s does not support snapshots", g.name)
+	}
+	bw := bufio.NewWriter(w)
+	sw := &snapshotWriter{w: bw, crc: crc32.NewIEEE()}
+	sw.write([]byte(snapshotMagic))
+	sw.write([]byte{snapshotVersion})
+	sw.writeBytes([]byte(g.name))
+	var count uint64
+	for _, e := range entries {
+		if e.value.notFound {
+			sw.write([]byte{recordNotFound})
+			sw.writeBytes([]byte(e.key))
+		} else {
+			sw.write([]byte{recordValue})
+			sw.writeBytes([]byte(e.key))
+			sw.writeBytes(e.value.b)
+		}
+		sw.writeVarint(expireToProto(e.value.e))
+		count++
+	}
+	sw.write([]byte{recordEnd})
+	sw.writeUvarint(count)
+	if sw.err != nil {
+		return sw.err
+	}
+	if _, err := bw.Write(binary.BigEndian.AppendUint32(nil, sw.crc.Sum32())); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Restore 读取Snapshot写出的快照并放进mainCache，已经过期的记录会被跳过。
+// 整个快照校验通过之后才会修改缓存，快照损坏时返回ErrBadSnapshot，缓存保持不变
+func (g *Group) Restore(r io.Reader) error {
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+	magic := sr.read(len(snapshotMagic))
+	if sr.err == nil && string(magic) != snapshotMagic {
+		return ErrBadSnapshot
+	}
+	if version := sr.read(1); sr.err == nil && version[0] != snapshotVersion {
+		return fmt.Errorf("geecache: unsupported snapshot version %d", version[0])
+	}
+	if name := sr.readBytes(); sr.err == nil && string(name) != g.name {
+		return fmt.Errorf("geecache: snapshot of group %s cannot be restored into %s", name, g.name)
+	}
+	var entries []cacheEntry
+	for sr.err == nil {
+		kind := sr.read(1)
+		if sr.err != nil || kind[0] == recordEnd {
+			break
+		}
+		if kind[0] != recordValue && kind[0] != recordNotFound {
+			return ErrBadSnapshot
+		}
+		e := cacheEntry{key: string(sr.readBytes())}
+		if kind[0] == recordValue {
+			e.value.b = sr.readBytes()
+		} else {
+			e.value.notFound = true
+		}
+		e.value.e = expireFromProto(sr.readVarint())
+		entries = append(entries, e)
+	}
+	count := sr.readUvarint()
+	sum := sr.crc.Sum32()
+	trailer := make([]byte, 4)
+	if sr.err == nil {
+		_, sr.err = io.ReadFull(sr.r, trailer)
+	}
+	if sr.err != nil {
+		// 文件提前结束也说明快照不完整
+		if errors.Is(sr.err, io.EOF) || errors.Is(sr.err, io.ErrUnexpectedEOF) {
+			return ErrBadSnapshot
+		}
+		return sr.err
+	}
+	if count != uint64(len(entries)) || binary.BigEndian.Uint32(trailer) != sum {
+		return ErrBadSnapshot
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		if e.value.expired(now) {
+			continue
+		}
+		if !e.value.notFound {
+			g.addToFilter(e.key)
+		}
+		g.populateCache(e.key, e.value)
+	}
+	return nil
+}
+
+// SnapshotFile 把快照写到path，先写临时文件再重命名，写到一半崩溃也不会破坏原来的快照
+func (g *Group) SnapshotFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // 重命名成功之后这里什么也不做
+	if err = g.Snapshot(f); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// RestoreFile 从path恢复快照，文件不存在时返回的错误满足errors.Is(err, fs.ErrNotExist)
+func (g *Group) RestoreFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return g.Restore(f)
+}
+
+// 每隔interval把mainCache保存到path
+func snapshotter(g *Group, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := g.SnapshotFile(path); err != nil {
+			log.Println("[MikuCache] Failed to save snapshot", err)
+		}
+	}
+}
+
+// snapshotWriter 在写入的同时计算crc32，出错之后的写入都被忽略，最后检查err
+type snapshotWriter struct {
+	w   io.Writer
+	crc hash.Hash32
+	err error
+}
+
+func (w *snapshotWriter) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	if _, w.err = w.w.Write(b); w.err == nil {
+		w.crc.Write(b)
+	}
+}
+
+func (w *snapshotWriter) writeUvarint(x uint64) {
+	w.write(binary.AppendUvarint(nil, x))
+}
+
+func (w *snapshotWriter) writeVarint(x int64) {
+	w.write(binary.AppendVarint(nil, x))
+}
+
+func (w *snapshotWriter) writeBytes(b []byte) {
+	w.writeUvarint(uint64(len(b)))
+	w.write(b)
+}
+
+// snapshotReader 在读取的同时计算crc32，和snapshotWriter对应
+type snapshotReader struct {
+	r       *bufio.Reader
+	crc     hash.Hash32
+	err     error
+	readErr error // ReadByte最近一次读取的错误，用来区分varint溢出和读取失败
+}
+
+func (r *snapshotReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	if _, r.err = io.ReadFull(r.r, b); r.err != nil {
+		return nil
+	}
+	r.crc.Write(b)
+	return b
+}
+
+// 实现io.ByteReader，给binary.ReadUvarint使用
+func (r *snapshotReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.crc.Write([]byte{b})
+	}
+	r.readErr = err
+	return b, err
+}
+
+func (r *snapshotReader) readUvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	x, err := binary.ReadUvarint(r)
+	r.setVarintErr(err)
+	return x
+}
+
+func (r *snapshotReader) readVarint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	x, err := binary.ReadVarint(r)
+	r.setVarintErr(err)
+	return x
+}
+
+// 读取没有出错但varint解码失败，说明数据溢出了
+func (r *snapshotReader) setVarintErr(err error) {
+	if err != nil && r.readErr == nil {
+		err = ErrBadSnapshot
+	}
+	r.err = err
+}
+
+func (r *snapshotReader) readBytes() []byte {
+	n := r.readUvarint()
+	if r.err == nil && n > maxSnapshotField {
+		r.err = ErrBadSnapshot
+	}
+	return r.read(int(n))
+}
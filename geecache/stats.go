@@ -0,0 +1,56 @@
+package geecache
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// AtomicInt 是可以并发读写的int64
+type AtomicInt int64
+
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// Stats 是Group的统计数据
+type Stats struct {
+	Gets           AtomicInt // 所有的Get请求，包括来自其他节点的
+	CacheHits      AtomicInt // mainCache或hotCache命中的次数
+	PeerLoads      AtomicInt // 从远程节点成功取回的次数
+	PeerErrors     AtomicInt // 从远程节点取值失败的次数
+	Loads          AtomicInt // 缓存未命中，需要load的次数 (gets - cacheHits)
+	LoadsDeduped   AtomicInt // 真正访问L2Cache、副本、远程节点或Getter的load次数，Loads-LoadsDeduped-RecheckHits就是被合并掉的请求数
+	RecheckHits    AtomicInt // load开始后再查缓存就命中的次数（另一次load刚好结束），不计入CacheHits
+	LocalLoads     AtomicInt // 本地通过Getter成功加载的次数
+	LocalLoadErrs  AtomicInt // 本地通过Getter加载失败的次数，key不存在不算失败
+	ServerRequests AtomicInt // 来自其他节点的请求数
+	FilterRejects  AtomicInt // 被KeyFilter判断为不存在而直接拒绝的次数
+	L2Hits         AtomicInt // 内存未命中但L2Cache命中的次数
+	L2Drops        AtomicInt // 写入队列已满，没有写进L2Cache就被丢弃的淘汰值
+	KeysHandedOff  AtomicInt // 哈希环变化或者节点关闭时交给新的负责节点的key数量
+}
+
+// CacheType 表示Group中的哪一个缓存
+type CacheType int
+
+const (
+	MainCache CacheType = iota + 1 // 本节点负责的key
+	HotCache                       // 从远程节点取回的热点key
+)
+
+// CacheStats 是单个缓存的统计数据
+type CacheStats struct {
+	Bytes     int64 // 已使用的内存
+	Items     int64 // 记录数
+	Gets      int64
+	Hits      int64
+	Evictions int64 // 因为容量或过期被清除的记录数，不包括主动删除的
+}
@@ -0,0 +1,105 @@
+package geecache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// peerAllowlist 是允许的节点身份，为nil时不限制
+type peerAllowlist map[string]bool
+
+func newPeerAllowlist(ids []string) peerAllowlist {
+	allow := make(peerAllowlist, len(ids))
+	for _, id := range ids {
+		allow[id] = true
+	}
+	return allow
+}
+
+// 证书中可以作为节点身份的名字：CommonName、DNS名、IP和URI
+func certIdentities(cert *x509.Certificate) []string {
+	ids := []string{cert.Subject.CommonName}
+	ids = append(ids, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		ids = append(ids, ip.String())
+	}
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	return ids
+}
+
+// 节点配置了Authenticator、身份名单或TLS时才能确认调用方的身份。
+// 都没有配置时集群信任网络中的所有请求，离开通知也直接接受
+func verifiesIdentity(auth Authenticator, allowlist peerAllowlist, cfg *tls.Config) bool {
+	return auth != nil || allowlist != nil || cfg != nil
+}
+
+// 调用方的身份是不是peer：认证得到的名字就是peer的地址，
+// 或者校验过的证书中有peer的地址或主机名。HTTP节点的地址带协议前缀，gRPC节点不带
+func leaveAllowed(cs *tls.ConnectionState, caller, peer string) bool {
+	if caller == peer {
+		return true
+	}
+	if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return false
+	}
+	host := peer
+	if u, err := url.Parse(peer); err == nil && u.Host != "" {
+		host = u.Hostname()
+	} else if h, _, err := net.SplitHostPort(peer); err == nil {
+		host = h
+	}
+	for _, id := range certIdentities(cs.VerifiedChains[0][0]) {
+		if id != "" && (id == peer || id == host) {
+			return true
+		}
+	}
+	return false
+}
+
+// 对方经过校验的证书中有一个身份在名单中就允许。
+// PeerCertificates只是对方发来的证书，ClientAuth不是RequireAndVerifyClientCert
+// 或者设置了InsecureSkipVerify时没有被校验过，所以只看VerifiedChains
+func (a peerAllowlist) allowed(cs *tls.ConnectionState) bool {
+	if a == nil {
+		return true
+	}
+	if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return false
+	}
+	for _, id := range certIdentities(cs.VerifiedChains[0][0]) {
+		if id != "" && a[id] {
+			return true
+		}
+	}
+	return false
+}
+
+func (a peerAllowlist) allowedRequest(r *http.Request) bool {
+	return a.allowed(r.TLS)
+}
+
+// 访问其他节点时使用的TLS配置，对方的证书也必须在名单中
+func (a peerAllowlist) clientConfig(cfg *tls.Config) *tls.Config {
+	cfg = cfg.Clone()
+	if a != nil {
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if a.allowed(&cs) {
+				return nil
+			}
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("geecache: peer %s did not present a certificate", cs.ServerName)
+			}
+			if len(cs.VerifiedChains) == 0 {
+				return fmt.Errorf("geecache: certificate of peer %s was not verified", cs.ServerName)
+			}
+			return fmt.Errorf("geecache: peer %v is not in the allowlist", certIdentities(cs.PeerCertificates[0]))
+		}
+	}
+	return cfg
+}
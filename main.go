@@ -1,14 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"mikucache/geecache"
+	"mikucache/geecache/certs"
+	"mikucache/geecache/discovery"
+	"mikucache/geecache/diskcache"
+	"mikucache/geecache/gossip"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 )
 
 var db = map[string]string{
@@ -17,32 +28,221 @@ var db = map[string]string{
 	"Sam":  "567",
 }
 
+// 不存在的key的缓存时间，避免反复查询不存在的key打到数据库上
+const negativeTTL = 30 * time.Second
+
+// 快照文件的路径和定期保存的间隔，路径为空时不保存
+var snapshotPath string
+
+const snapshotInterval = time.Minute
+
+// 磁盘缓存的目录和大小上限，目录为空时只使用内存缓存
+var diskDir string
+
+const diskBytes = 1 << 30
+
 func createGroup() *geecache.Group {
+	opts := []geecache.GroupOption{
+		geecache.WithNegativeTTL(negativeTTL),
+		geecache.WithSnapshot(snapshotPath, snapshotInterval),
+	}
+	if diskDir != "" {
+		store, err := diskcache.Open(diskDir, diskBytes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, geecache.WithL2Cache(store))
+	}
 	return geecache.NewGroup("scores", 2<<10, geecache.GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
+			return nil, fmt.Errorf("%s not exist: %w", key, geecache.ErrNotFound)
 		},
-	))
+	), opts...)
+}
+
+// 节点列表的刷新间隔
+const discoveryInterval = 10 * time.Second
+
+// gossip的UDP监听地址和种子节点，为空时使用disc定期同步节点列表
+var (
+	gossipAddr  string
+	gossipSeeds string
+)
+
+// 每个key存放在几个节点上
+var replication int
+
+// 根据启动参数选择gossip或者discovery来维护哈希环
+func watchPeers(self string, disc discovery.Discovery, m discovery.Membership) {
+	if gossipAddr == "" {
+		go discovery.Watch(context.Background(), disc, discoveryInterval, m)
+		return
+	}
+	var seeds []string
+	if gossipSeeds != "" {
+		seeds = strings.Split(gossipSeeds, ",")
+	}
+	if _, err := gossip.New(gossip.Config{
+		Name:       self,
+		BindAddr:   gossipAddr,
+		Seeds:      seeds,
+		Membership: m,
+		Secret:     peerSecret,
+	}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// 关闭时最多等待这么久，让正在处理的请求和加载完成
+const shutdownTimeout = 10 * time.Second
+
+// 关闭前最热的这么多个key交给新的负责节点
+const handoffKeys = 100
+
+// 节点列表变化之后最多转移的key数量和带宽上限
+const (
+	rebalanceKeys        = 1000
+	rebalanceBytesPerSec = 10 << 20
+)
+
+// 节点之间的TLS配置和允许的节点身份，tlsConfig为nil时使用明文
+var (
+	tlsConfig     *tls.Config
+	peerAllowlist []string
+)
+
+// 节点之间和/api的认证方式，为nil时不认证
+var (
+	peerAuth geecache.Authenticator
+	apiAuth  geecache.Authenticator
+)
+
+// 节点之间共享的HMAC密钥，同时用来签名gossip消息，为nil时gossip只能在可信的网络中使用
+var peerSecret []byte
+
+// 读取节点之间共享的HMAC密钥
+func loadSecret(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	secret := bytes.TrimSpace(data)
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("empty secret in %s", file)
+	}
+	return secret, nil
 }
 
-func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
-	peers := geecache.NewHTTPPool(addr)
-	peers.Set(addrs...)
+// 读取/api的token文件，每行是 "token 调用方名字"，#开头的行是注释
+func loadTokens(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want \"token name\"", file, i+1)
+		}
+		tokens[fields[0]] = fields[1]
+	}
+	return tokens, nil
+}
+
+func newCacheServer(addr string, disc discovery.Discovery, gee *geecache.Group) *geecache.Server {
+	opts := []geecache.HTTPPoolOption{
+		geecache.WithRetries(2, 50*time.Millisecond),
+		geecache.WithCircuitBreaker(5, 10*time.Second),
+		geecache.WithRerouting(),
+		geecache.WithReplication(replication),
+		geecache.WithRebalance(rebalanceKeys, rebalanceBytesPerSec),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, geecache.WithTLSConfig(tlsConfig))
+	}
+	if peerAllowlist != nil {
+		opts = append(opts, geecache.WithPeerAllowlist(peerAllowlist...))
+	}
+	if peerAuth != nil {
+		opts = append(opts, geecache.WithAuthenticator(peerAuth))
+	}
+	peers := geecache.NewHTTPPool(addr, opts...)
+	watchPeers(addr, disc, peers)
+	gee.RegisterPeers(peers)
+	mux := http.NewServeMux()
+	mux.Handle("/_geecache/", peers)
+	mux.Handle("/metrics", peers.Guard(geecache.PermRead, geecache.NewMetricsHandler(peers)))
+	return geecache.NewServer(peers, geecache.WithHandler(mux), geecache.WithHandoff(handoffKeys))
+}
+
+// 收到信号后先关闭节点，保存快照然后退出
+func exitOnSignal(sigChan <-chan os.Signal, gee *geecache.Group, shutdown func(ctx context.Context) error) {
+	<-sigChan
+	log.Println("Received interrupt signal,shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := shutdown(ctx); err != nil {
+		log.Println("shutdown failed:", err)
+	}
+	cancel()
+	// 退出前保存快照，重启之后不用全部从数据库重新加载
+	if snapshotPath != "" {
+		if err := gee.SnapshotFile(snapshotPath); err != nil {
+			log.Println("save snapshot failed:", err)
+		}
+	}
+	os.Exit(0)
+}
+
+// 节点之间使用gRPC通信，addr是不带协议前缀的host:port
+func newGRPCCachePool(addr string, disc discovery.Discovery, gee *geecache.Group) *geecache.GRPCPool {
+	opts := []geecache.GRPCPoolOption{
+		geecache.WithGRPCReplication(replication),
+		geecache.WithGRPCHandoff(handoffKeys),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, geecache.WithGRPCTLSConfig(tlsConfig))
+	}
+	if peerAllowlist != nil {
+		opts = append(opts, geecache.WithGRPCPeerAllowlist(peerAllowlist...))
+	}
+	if peerAuth != nil {
+		opts = append(opts, geecache.WithGRPCAuthenticator(peerAuth))
+	}
+	peers := geecache.NewGRPCPool(addr, opts...)
+	watchPeers(addr, disc, peers)
 	gee.RegisterPeers(peers)
-	log.Println("geecache is running at ", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peers)) // 去除http://前缀
+	return peers
 }
 
 // 修复了函数签名中的参数类型错误，将 http.Response 改为 http.ResponseWriter
 func startAPIServer(apiAddr string, gee *geecache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
+			caller, err := geecache.AuthenticateHTTP(apiAuth, r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if err = gee.Authorize(caller, geecache.PermRead); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
 			key := r.URL.Query().Get("key")
-			view, err := gee.Get(key)
+			// 客户端断开时r.Context()会被取消，不再继续等待加载
+			view, err := gee.GetContext(r.Context(), key)
+			if errors.Is(err, geecache.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -52,36 +252,107 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 		},
 	))
 	log.Println("fontend server is running at", apiAddr)
-	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
+	log.Fatal(http.ListenAndServe(apiAddr, nil))
 }
 func main() {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		<-sigChan
-		log.Println("Received interrupt signal,shutting down...")
-		os.Exit(0)
-	}()
-
 	var port int
 	var api bool
+	var protocol string
+	var peersFile string
+	var certFile, keyFile, caFile, allow string
+	var secretFile, tokensFile string
 	flag.IntVar(&port, "port", 8001, "Geecache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.StringVar(&protocol, "protocol", "http", "Peer protocol: http or grpc")
+	flag.StringVar(&peersFile, "peers", "", "File listing peers, one \"addr [weight]\" per line, reloaded periodically")
+	flag.StringVar(&gossipAddr, "gossip", "", "UDP address for gossip membership, e.g. localhost:7001; messages are signed with -auth-secret, without it use only on a trusted network")
+	flag.StringVar(&gossipSeeds, "seeds", "", "Comma separated gossip addresses of seed nodes")
+	flag.IntVar(&replication, "replicas", 1, "Number of nodes each key is stored on")
+	flag.StringVar(&snapshotPath, "snapshot", "", "File to save the cache to periodically and on shutdown, restored on start")
+	flag.StringVar(&diskDir, "disk", "", "Directory for the on-disk cache holding values evicted from memory")
+	flag.StringVar(&certFile, "tls-cert", "", "PEM certificate of this node, enables mutual TLS between peers together with -tls-key and -tls-ca")
+	flag.StringVar(&keyFile, "tls-key", "", "PEM private key of -tls-cert")
+	flag.StringVar(&caFile, "tls-ca", "", "PEM certificate of the CA that signs all peer certificates")
+	flag.StringVar(&allow, "allow", "", "Comma separated peer identities (certificate CN, DNS name, IP or URI) allowed to connect")
+	flag.StringVar(&secretFile, "auth-secret", "", "File holding the HMAC secret shared by all peers, peer requests without a valid signature are rejected")
+	flag.StringVar(&tokensFile, "api-tokens", "", "File of \"token name\" lines, requests to /api must carry one as a bearer token")
 	flag.Parse()
-	apiAddr := "http://localhost:9999"
-	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
+	if certFile != "" || keyFile != "" || caFile != "" {
+		var err error
+		if tlsConfig, err = certs.LoadConfig(certFile, keyFile, caFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if allow != "" {
+		peerAllowlist = strings.Split(allow, ",")
+	}
+	apiAddr := "localhost:9999"
+	hostMap := map[int]string{
+		8001: "localhost:8001",
+		8002: "localhost:8002",
+		8003: "localhost:8003",
+	}
+	// HTTP节点的地址带协议前缀，gRPC节点不带
+	scheme := "http://"
+	if tlsConfig != nil {
+		scheme = "https://"
 	}
+	addrMap := make(map[int]string, len(hostMap))
 	var addrs []string
-	for _, v := range addrMap {
-		addrs = append(addrs, v)
+	for port, host := range hostMap {
+		if protocol != "grpc" {
+			host = scheme + host
+		}
+		addrMap[port] = host
+		addrs = append(addrs, host)
+	}
+	if secretFile != "" {
+		secret, err := loadSecret(secretFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		peerAuth = geecache.NewHMACAuth(addrMap[port], secret)
+		peerSecret = secret
+	}
+	if tokensFile != "" {
+		tokens, err := loadTokens(tokensFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		apiAuth = geecache.NewBearerAuth("", tokens)
+	}
+	// 没有指定节点列表文件时使用上面写死的三个节点
+	var disc discovery.Discovery = discovery.Static(addrs)
+	if peersFile != "" {
+		disc = discovery.StaticFile{Path: peersFile}
 	}
 	gee := createGroup()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	if api {
 		go startAPIServer(apiAddr, gee)
 	}
-	startCacheServer(addrMap[port], addrs, gee)
+	if protocol == "grpc" {
+		peers := newGRPCCachePool(addrMap[port], disc, gee)
+		go exitOnSignal(sigChan, gee, peers.Shutdown)
+		lis, err := net.Listen("tcp", addrMap[port])
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("geecache(grpc) is running at ", addrMap[port])
+		// Shutdown之后Serve返回nil，由exitOnSignal保存快照并退出
+		if err = peers.Serve(lis); err != nil {
+			log.Fatal(err)
+		}
+		select {}
+	}
+	srv := newCacheServer(addrMap[port], disc, gee)
+	go exitOnSignal(sigChan, gee, srv.Shutdown)
+	log.Println("geecache is running at ", addrMap[port])
+	if err := srv.ListenAndServe(addrMap[port]); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	// Shutdown之后由exitOnSignal保存快照并退出
+	select {}
 }
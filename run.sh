@@ -1,2 +1,2 @@
 #!/bin/bash
-./mikucache-linux -port 8001 & ./mikucache-linux -port 8002 & ./mikucache-linux -port 8003 -api=1
\ No newline at end of file
+./mikucache-linux -port 8001 -snapshot /tmp/mikucache-8001.snap -disk /tmp/mikucache-8001 & ./mikucache-linux -port 8002 -snapshot /tmp/mikucache-8002.snap -disk /tmp/mikucache-8002 & ./mikucache-linux -port 8003 -snapshot /tmp/mikucache-8003.snap -disk /tmp/mikucache-8003 -api=1